@@ -34,9 +34,67 @@ This command displays the final configuration that gencmd uses, computed from:
 	},
 }
 
+// configValidateCmd represents the config validate command
+var configValidateCmd = &cobra.Command{
+	Use:   "validate [path]",
+	Short: "Validate the configuration file",
+	Long: `Strictly validate the configuration file.
+
+Unknown fields, values not allowed by the configuration schema, missing
+settings and invalid prompt templates are reported together with the line
+they were found at. When no path is given, the default configuration file
+is validated.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runConfigValidate(cmd, args); err != nil {
+			fmt.Fprintf(cmd.OutOrStderr(), "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// configGetCmd represents the config get command
+var configGetCmd = &cobra.Command{
+	Use:   "get [key]",
+	Short: "Print a configuration value",
+	Long: `Print a value of the computed configuration, given its dotted key.
+
+When no key is given, the whole configuration is printed.`,
+	Example: `  gencmd config get llm.modelName`,
+	Args:    cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runConfigGet(cmd, args); err != nil {
+			fmt.Fprintf(cmd.OutOrStderr(), "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// configSetCmd represents the config set command
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Change a value in the configuration file",
+	Long: `Change a value in the configuration file, given its dotted key.
+
+Comments and the order of the existing settings are preserved. The value is
+validated against the configuration schema before the file is written.`,
+	Example: `  gencmd config set llm.provider openai
+  gencmd config set llm.modelName gpt-4.1-mini`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runConfigSet(cmd, args); err != nil {
+			fmt.Fprintf(cmd.OutOrStderr(), "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
 func init() {
 	rootCmd.AddCommand(configCmd)
 	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
 }
 
 func runConfigShow(cmd *cobra.Command) error {
@@ -47,3 +105,55 @@ func runConfigShow(cmd *cobra.Command) error {
 	_, err = fmt.Fprintf(cmd.OutOrStdout(), "%s", cfg.String())
 	return err
 }
+
+func runConfigValidate(cmd *cobra.Command, args []string) error {
+	var path string
+	if len(args) > 0 {
+		path = args[0]
+	} else {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+		path = cfg.Path()
+	}
+
+	errs, err := config.Validate(path)
+	if err != nil {
+		return err
+	}
+	for _, verr := range errs {
+		fmt.Fprintf(cmd.OutOrStdout(), "%s: %v\n", path, verr)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("found %d problem(s) in %s", len(errs), path)
+	}
+	_, err = fmt.Fprintf(cmd.OutOrStdout(), "%s: configuration is valid\n", path)
+	return err
+}
+
+func runConfigGet(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	key := ""
+	if len(args) > 0 {
+		key = args[0]
+	}
+	val, err := cfg.Get(key)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), val)
+	return err
+}
+
+func runConfigSet(cmd *cobra.Command, args []string) error {
+	path := config.Path()
+	if err := config.Set(path, args[0], args[1]); err != nil {
+		return err
+	}
+	cmd.Printf("Updated %s in %s\n", args[0], path)
+	return nil
+}
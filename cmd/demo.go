@@ -16,6 +16,7 @@ var demoCmd = &cobra.Command{
 	Run: func(*cobra.Command, []string) {
 		err := ui.RunUI(ui.NewFakeController(), ui.Options{
 			TtyPath: ttyPath,
+			Height:  uiHeight,
 		})
 		if err != nil {
 			// Do not print the error if the user cancelled the operation.
@@ -31,4 +32,5 @@ func init() {
 	rootCmd.AddCommand(demoCmd)
 
 	demoCmd.Flags().StringVar(&ttyPath, "tty", "", "Path to the TTY device to use. Defaults to the current terminal.")
+	demoCmd.Flags().StringVar(&uiHeight, "height", "", "Render inline below the prompt in the given lines or percentage of the terminal (e.g. 40%), instead of full screen.")
 }
@@ -0,0 +1,293 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/joho/godotenv"
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+
+	"github.com/mbrt/gencmd/config"
+	"github.com/mbrt/gencmd/ctrl"
+)
+
+const (
+	doctorPrompt  = "list files in the current directory"
+	doctorTimeout = 30 * time.Second
+)
+
+var skipGenerate bool
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Diagnose common problems with the gencmd setup",
+	Long: `Run a series of checks on the gencmd setup and print the result of each.
+
+The checks cover the configuration files, the provider credentials, a test
+generation, the terminal and the shell key bindings. Failed checks come with
+a hint on how to fix them.`,
+	Run: func(cmd *cobra.Command, _ []string) {
+		if !runDoctor(cmd) {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+	doctorCmd.Flags().BoolVar(&skipGenerate, "skip-generate", false, "Do not send a test prompt to the provider.")
+	doctorCmd.Flags().StringVar(&ttyPath, "tty", "", "Path to the TTY device to check. Defaults to the current terminal.")
+}
+
+// checkResult is the outcome of a single doctor check.
+type checkResult struct {
+	// Detail is printed next to the check name.
+	Detail string
+	// Hint explains how to fix a failed check.
+	Hint string
+	Err  error
+}
+
+type doctorCheck struct {
+	Name string
+	Run  func(cfg config.Config) checkResult
+}
+
+func runDoctor(cmd *cobra.Command) bool {
+	cfg, _ := config.Load()
+
+	checks := []doctorCheck{
+		{Name: "Configuration file", Run: checkConfigFile},
+		{Name: "Environment file", Run: checkEnvFile},
+		{Name: "File permissions", Run: checkPermissions},
+		{Name: "Provider credentials", Run: checkProviderEnv},
+		{Name: "Test generation", Run: checkGeneration},
+		{Name: "Terminal", Run: checkTTY},
+		{Name: "Key bindings", Run: checkKeyBindings},
+	}
+
+	ok := true
+	for _, c := range checks {
+		res := c.Run(cfg)
+		status := "PASS"
+		if res.Err != nil {
+			status = "FAIL"
+			ok = false
+		}
+		line := fmt.Sprintf("[%s] %s", status, c.Name)
+		if res.Detail != "" {
+			line += ": " + res.Detail
+		}
+		cmd.Println(line)
+		if res.Err != nil {
+			cmd.Printf("       error: %v\n", res.Err)
+			if res.Hint != "" {
+				cmd.Printf("       hint: %s\n", res.Hint)
+			}
+		}
+	}
+	return ok
+}
+
+func checkConfigFile(config.Config) checkResult {
+	path := config.Path()
+	errs, err := config.Validate(path)
+	if err != nil {
+		return checkResult{
+			Detail: path,
+			Hint:   "run `gencmd init` to create a default configuration",
+			Err:    err,
+		}
+	}
+	if len(errs) > 0 {
+		var msgs []string
+		for _, verr := range errs {
+			msgs = append(msgs, verr.Error())
+		}
+		return checkResult{
+			Detail: path,
+			Hint:   "fix the reported problems; run `gencmd config validate` to check again",
+			Err:    errors.New(strings.Join(msgs, "; ")),
+		}
+	}
+	return checkResult{Detail: path}
+}
+
+func checkEnvFile(cfg config.Config) checkResult {
+	path := envFilePath(cfg)
+	if _, err := os.Stat(path); err != nil {
+		return checkResult{
+			Detail: path,
+			Hint:   "run `gencmd init` to create it",
+			Err:    err,
+		}
+	}
+	if _, err := godotenv.Read(path); err != nil {
+		return checkResult{
+			Detail: path,
+			Hint:   "make sure every line has the form KEY=value, or is a comment",
+			Err:    err,
+		}
+	}
+	return checkResult{Detail: path}
+}
+
+func checkPermissions(cfg config.Config) checkResult {
+	var unsafe []string
+	checked := 0
+	for _, path := range []string{config.Path(), envFilePath(cfg)} {
+		fi, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		checked++
+		if fi.Mode().Perm()&0o077 != 0 {
+			unsafe = append(unsafe, fmt.Sprintf("%s (%s)", path, fi.Mode().Perm()))
+		}
+	}
+	if len(unsafe) > 0 {
+		return checkResult{
+			Hint: fmt.Sprintf("run `chmod 600 %s %s`", config.Path(), envFilePath(cfg)),
+			Err:  fmt.Errorf("readable by other users: %s", strings.Join(unsafe, ", ")),
+		}
+	}
+	if checked == 0 {
+		return checkResult{Detail: "no configuration files to check"}
+	}
+	return checkResult{Detail: "only accessible by the current user"}
+}
+
+func checkProviderEnv(cfg config.Config) checkResult {
+	if cfg.LLM.Provider == "" {
+		return checkResult{
+			Hint: "run `gencmd init` to configure a provider",
+			Err:  errors.New("no provider configured"),
+		}
+	}
+	var missing []string
+	for _, p := range config.ProvidersInitOptions() {
+		if p.ID != cfg.LLM.Provider {
+			continue
+		}
+		for _, opt := range p.Options {
+			if os.Getenv(opt.EnvVar) != "" {
+				continue
+			}
+			if opt.Secret && (cfg.LLM.APIKeyCommand != "" || os.Getenv(opt.CommandEnvVar()) != "") {
+				continue
+			}
+			missing = append(missing, opt.EnvVar)
+		}
+	}
+	if len(missing) > 0 {
+		return checkResult{
+			Detail: cfg.LLM.Provider,
+			Hint:   fmt.Sprintf("run `gencmd init --reset`, or set the variables in %s", envFilePath(cfg)),
+			Err:    fmt.Errorf("missing environment variables: %s", strings.Join(missing, ", ")),
+		}
+	}
+	return checkResult{Detail: cfg.LLM.Provider}
+}
+
+func checkGeneration(cfg config.Config) checkResult {
+	if skipGenerate {
+		return checkResult{Detail: "skipped"}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	defer cancel()
+	start := time.Now()
+	gen, err := ctrl.New(cfg).GenerateContext(ctx, doctorPrompt)
+	latency := time.Since(start).Round(time.Millisecond)
+
+	hint := "check the provider credentials, the model name and the network connection"
+	switch {
+	case err != nil && ctx.Err() != nil:
+		return checkResult{Hint: hint, Err: fmt.Errorf("no answer after %v", doctorTimeout)}
+	case err != nil:
+		return checkResult{Hint: hint, Err: err}
+	case len(gen.PreferredCommands()) == 0:
+		return checkResult{Hint: hint, Err: errors.New("no commands generated")}
+	}
+	return checkResult{
+		Detail: fmt.Sprintf("%s/%s answered in %v", cfg.LLM.Provider, cfg.LLM.ModelName, latency),
+	}
+}
+
+func checkTTY(config.Config) checkResult {
+	path := ttyPath
+	if path == "" {
+		path = "/dev/tty"
+	}
+	hint := "run gencmd from an interactive terminal, or pass a terminal device with --tty"
+	tty, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return checkResult{Detail: path, Hint: hint, Err: err}
+	}
+	defer tty.Close()
+	if !isatty.IsTerminal(tty.Fd()) {
+		return checkResult{Detail: path, Hint: hint, Err: errors.New("not a terminal")}
+	}
+	if term := os.Getenv("TERM"); term == "" || term == "dumb" {
+		return checkResult{
+			Detail: path,
+			Hint:   "set TERM to your terminal type, e.g. xterm-256color",
+			Err:    fmt.Errorf("unsupported terminal type %q", term),
+		}
+	}
+	return checkResult{Detail: path}
+}
+
+func checkKeyBindings(config.Config) checkResult {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return checkResult{Err: err}
+	}
+	zdotdir := os.Getenv("ZDOTDIR")
+	if zdotdir == "" {
+		zdotdir = home
+	}
+	rcFiles := []string{
+		filepath.Join(home, ".bashrc"),
+		filepath.Join(home, ".bash_profile"),
+		filepath.Join(zdotdir, ".zshrc"),
+		filepath.Join(xdg.ConfigHome, "fish", "config.fish"),
+		filepath.Join(xdg.ConfigHome, "nushell", "config.nu"),
+		filepath.Join(xdg.ConfigHome, "powershell", "Microsoft.PowerShell_profile.ps1"),
+	}
+
+	for _, rc := range rcFiles {
+		b, err := os.ReadFile(rc)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(b), "\n") {
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, "#") {
+				continue
+			}
+			if strings.Contains(line, "gencmd") && strings.Contains(line, "key-bindings.") {
+				return checkResult{Detail: "sourced in " + rc}
+			}
+		}
+	}
+	return checkResult{
+		Hint: fmt.Sprintf("source the key-bindings file for your shell from %s (see `gencmd init`)", config.Dir()),
+		Err:  errors.New("key bindings are not sourced in any shell rc file"),
+	}
+}
+
+func envFilePath(cfg config.Config) string {
+	if p := cfg.EnvPath(); p != "" {
+		return p
+	}
+	return filepath.Join(config.Dir(), ".env")
+}
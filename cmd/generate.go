@@ -1,9 +1,14 @@
 package cmd
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -11,7 +16,30 @@ import (
 	"github.com/mbrt/gencmd/ctrl"
 )
 
-var firstOnly bool
+// Exit codes of the generate command. Other errors, like invalid flags,
+// exit with 1.
+const (
+	exitConfigError     = 2
+	exitGenerationError = 3
+	exitNoCommands      = 4
+)
+
+// Output formats of the generate command.
+const (
+	outputText  = "text"
+	outputJSON  = "json"
+	outputJSONL = "jsonl"
+	outputNul   = "nul"
+)
+
+var (
+	firstOnly        bool
+	outputFormat     string
+	batchPath        string
+	batchConcurrency int
+	batchRetries     int
+	noStdin          bool
+)
 
 // generateCmd represents the generate command
 var generateCmd = &cobra.Command{
@@ -20,14 +48,48 @@ var generateCmd = &cobra.Command{
 	Long: `Generate shell commands without the interactive UI.
 
 This command takes a natural language prompt and generates one or more shell commands.
-The prompt can be provided as multiple arguments or as a single quoted string.`,
+The prompt can be provided as multiple arguments or as a single quoted string.
+
+The --output flag selects the output format:
+  text   one command per line (default)
+  json   a JSON object with the prompt, the commands with their validation
+         warnings, the provider, the model, the latency and whether the result
+         was cached
+  jsonl  like json, on a single line
+  nul    commands terminated by a NUL character, for multi-line commands
+
+Exit codes:
+  0  commands were generated
+  1  invalid usage or unexpected error
+  2  the configuration could not be loaded
+  3  the generation failed (e.g. provider or network errors)
+  4  no commands were generated
+
+When data is piped into gencmd, or a file is given with --context-file, a
+sample of it is included in the prompt, so that the model can see its format.
+The sample is limited to the first lines and common secrets are redacted. If
+no data arrives within a few seconds, stdin is ignored: use --no-stdin when it
+is a pipe nothing is written to (e.g. in editors and scripts).
+
+With --batch, prompts are read from a file (or stdin with -), one per line.
+Empty lines and lines starting with # are skipped. The results are written as
+JSONL in the same order as the prompts, with an "error" field for the prompts
+that failed. The exit code is 3 if any of them failed.`,
 	Example: `  gencmd generate list all files in current directory
-  gencmd generate --first "list all processes"`,
-	Args: cobra.MinimumNArgs(1),
+  gencmd generate --first "list all processes"
+  gencmd generate --output json "find large files"
+  kubectl get pods | gencmd generate "pick the crashlooping ones"
+  gencmd generate --batch prompts.txt --concurrency 8 > commands.jsonl`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if batchPath != "" {
+			return cobra.NoArgs(cmd, args)
+		}
+		return cobra.MinimumNArgs(1)(cmd, args)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := runGenerate(cmd, args); err != nil {
 			fmt.Fprintf(cmd.OutOrStderr(), "Error: %v\n", err)
-			os.Exit(1)
+			os.Exit(exitCode(err))
 		}
 	},
 }
@@ -35,36 +97,188 @@ The prompt can be provided as multiple arguments or as a single quoted string.`,
 func init() {
 	rootCmd.AddCommand(generateCmd)
 	generateCmd.Flags().BoolVarP(&firstOnly, "first", "f", false, "Select and output only the first generated command")
+	generateCmd.Flags().StringVarP(&outputFormat, "output", "o", outputText, "Output format: text, json, jsonl or nul")
+	generateCmd.Flags().StringVar(&batchPath, "batch", "", "Generate commands for each prompt in the given file, or stdin with -")
+	generateCmd.Flags().IntVar(&batchConcurrency, "concurrency", 4, "Maximum number of concurrent generations with --batch")
+	generateCmd.Flags().IntVar(&batchRetries, "retries", 2, "Number of retries for failed generations with --batch")
+	generateCmd.Flags().BoolVar(&noStdin, "no-stdin", false, "Don't read a sample of the data piped into gencmd, e.g. when stdin is an unused pipe")
+	generateCmd.Flags().StringVar(&ctxFile, "context-file", "", "File whose content is the input of the commands. Defaults to the data piped into gencmd, if any.")
+	generateCmd.Flags().StringVar(&shellName, "shell", "", "Shell to generate commands for (bash, zsh, fish, nushell, pwsh). Defaults to the configured or detected shell.")
 }
 
 func runGenerate(cmd *cobra.Command, args []string) error {
 	// Join all arguments with spaces to form the prompt
 	prompt := strings.Join(args, " ")
 
+	switch outputFormat {
+	case outputText, outputJSON, outputJSONL, outputNul:
+	default:
+		return fmt.Errorf("unsupported output format %q", outputFormat)
+	}
+	if batchPath != "" && outputFormat != outputText && outputFormat != outputJSONL {
+		return fmt.Errorf("--batch only supports the jsonl output format")
+	}
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
 		fmt.Fprintf(cmd.OutOrStderr(), missingCfgMsg, err)
-		return fmt.Errorf("failed to load configuration")
+		return withExitCode(exitConfigError, errors.New("failed to load configuration"))
+	}
+	warnInvalidConfig(cfg)
+	if err := applyShellFlag(&cfg); err != nil {
+		return err
 	}
 
 	// Generate commands
 	controller := ctrl.New(cfg)
-	commands, err := controller.GenerateCommands(prompt)
+	sample, err := inputSample(batchPath != "-" && !noStdin)
 	if err != nil {
-		return fmt.Errorf("generating commands: %w", err)
+		return err
 	}
-	if len(commands) == 0 {
-		return fmt.Errorf("no commands generated")
+	controller.SetInputSample(sample)
+	if batchPath != "" {
+		return runBatch(cmd, controller)
+	}
+	gen, err := controller.Generate(prompt)
+	if err != nil {
+		return withExitCode(exitGenerationError, fmt.Errorf("generating commands: %w", err))
+	}
+	if len(gen.Commands) == 0 {
+		return withExitCode(exitNoCommands, errors.New("no commands generated"))
 	}
 	if firstOnly {
 		// If --first is specified, only return the first command
-		commands = commands[:1]
+		gen.Commands = gen.Preferred()[:1]
 	}
 	// Output results
-	for _, command := range commands {
-		cmd.Println(command)
+	return writeGeneration(cmd.OutOrStdout(), outputFormat, gen)
+}
+
+// batchError is the output for a prompt that failed in batch mode.
+type batchError struct {
+	Prompt string `json:"prompt"`
+	Error  string `json:"error"`
+}
+
+func runBatch(cmd *cobra.Command, controller *ctrl.Controller) error {
+	prompts, err := readPrompts(cmd.InOrStdin(), batchPath)
+	if err != nil {
+		return err
+	}
+
+	opts := ctrl.BatchOptions{
+		Concurrency: batchConcurrency,
+		Retries:     batchRetries,
+		RetryDelay:  time.Second,
+	}
+	out := cmd.OutOrStdout()
+	failed := 0
+	for res := range controller.GenerateBatch(prompts, opts) {
+		if res.Err != nil {
+			failed++
+			if err := json.NewEncoder(out).Encode(batchError{res.Prompt, res.Err.Error()}); err != nil {
+				return fmt.Errorf("writing output: %w", err)
+			}
+			continue
+		}
+		gen := res.Generation
+		if firstOnly && len(gen.Commands) > 0 {
+			gen.Commands = gen.Preferred()[:1]
+		}
+		if err := writeGeneration(out, outputJSONL, gen); err != nil {
+			return err
+		}
 	}
 
+	if failed > 0 {
+		return withExitCode(exitGenerationError, fmt.Errorf("%d of %d prompts failed", failed, len(prompts)))
+	}
+	return nil
+}
+
+// readPrompts reads the prompts from path, or stdin if path is "-", skipping
+// empty lines and comments.
+func readPrompts(stdin io.Reader, path string) ([]string, error) {
+	r := stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("opening prompts file: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var prompts []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		prompts = append(prompts, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading prompts: %w", err)
+	}
+	return prompts, nil
+}
+
+// writeGeneration writes the generated commands in the given output format.
+// The text formats only include the preferred commands.
+func writeGeneration(w io.Writer, format string, gen ctrl.Generation) error {
+	var err error
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(gen)
+	case outputJSONL:
+		err = json.NewEncoder(w).Encode(gen)
+	case outputNul:
+		for _, command := range gen.PreferredCommands() {
+			if _, err = fmt.Fprint(w, command+"\x00"); err != nil {
+				break
+			}
+		}
+	default:
+		for _, command := range gen.PreferredCommands() {
+			if _, err = fmt.Fprintln(w, command); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("writing output: %w", err)
+	}
 	return nil
 }
+
+// exitError is an error that terminates the command with a specific exit
+// code.
+type exitError struct {
+	code int
+	err  error
+}
+
+func withExitCode(code int, err error) error {
+	return exitError{code: code, err: err}
+}
+
+func (e exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e exitError) Unwrap() error {
+	return e.err
+}
+
+// exitCode returns the exit code for the error, defaulting to 1.
+func exitCode(err error) int {
+	var eerr exitError
+	if errors.As(err, &eerr) {
+		return eerr.code
+	}
+	return 1
+}
@@ -0,0 +1,762 @@
+package cmd
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mbrt/gencmd/config"
+	"github.com/mbrt/gencmd/ctrl"
+	"github.com/mbrt/gencmd/ui"
+)
+
+var (
+	historyJSON    bool
+	historyLimit   int
+	historyAll     bool
+	historyYes     bool
+	historyPrompt  string
+	historyCommand string
+	historyFormat  string
+
+	importFile      string
+	importLimit     int
+	importDescribe  bool
+	importBatchSize int
+	importYes       bool
+
+	syncDir string
+)
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Manage the history of accepted commands",
+	Long: `Manage the history of the commands accepted in the interactive UI.
+
+Entries are identified by a short ID, shown by "list" and "search", which
+stays the same for all the uses of the same prompt and command.`,
+}
+
+// historyListCmd represents the history list command
+var historyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the history entries",
+	Long:  `List the history entries, in the same order as the interactive UI.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, _ []string) {
+		controller := newHistoryController()
+		if err := printHistory(cmd.OutOrStdout(), controller.LoadHistory()); err != nil {
+			fmt.Fprintf(cmd.OutOrStderr(), "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// historySearchCmd represents the history search command
+var historySearchCmd = &cobra.Command{
+	Use:   "search <query...>",
+	Short: "Search the history entries",
+	Long: `Fuzzy search the prompts and commands of the history entries, with the same
+matching as the interactive UI. The best matches are listed first.`,
+	Example: `  gencmd history search find jpg`,
+	Args:    cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		controller := newHistoryController()
+		matches := controller.SearchHistory(strings.Join(args, " "))
+		if err := printHistory(cmd.OutOrStdout(), matches); err != nil {
+			fmt.Fprintf(cmd.OutOrStderr(), "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// historyDeleteCmd represents the history delete command
+var historyDeleteCmd = &cobra.Command{
+	Use:   "delete <id|query...>",
+	Short: "Delete history entries",
+	Long: `Delete the history entry with the given ID or, if none matches, the one
+matching the query. When more entries match the query, they are listed and
+nothing is deleted, unless --all is given.
+
+With --all, only the entries containing every word of the query are deleted,
+without the fuzzy matches of "gencmd history search". They are listed, and
+deleted after confirmation, or right away with --yes.
+
+Like in the interactive UI, deleted entries are logged as rejected.`,
+	Example: `  gencmd history delete 1a2b3c4d
+  gencmd history delete --all find jpg
+  gencmd history delete --all --yes find jpg`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runHistoryDelete(cmd, args); err != nil {
+			fmt.Fprintf(cmd.OutOrStderr(), "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// historyEditCmd represents the history edit command
+var historyEditCmd = &cobra.Command{
+	Use:   "edit <id>",
+	Short: "Edit a history entry",
+	Long: `Edit the prompt or the command of a history entry.
+
+Without flags, the command is opened in $VISUAL or $EDITOR. Like in the
+interactive UI, the edited entry replaces the original.`,
+	Example: `  gencmd history edit 1a2b3c4d
+  gencmd history edit 1a2b3c4d --command 'ls -la'`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runHistoryEdit(cmd, args[0]); err != nil {
+			fmt.Fprintf(cmd.OutOrStderr(), "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// historyExportCmd represents the history export command
+var historyExportCmd = &cobra.Command{
+	Use:   "export [file]",
+	Short: "Export the history",
+	Long: `Export the history to a file, or to stdout when no file is given.
+
+The format is given with --format, or inferred from the file extension:
+  jsonl     all the details of the entries (default)
+  csv       the most relevant details, for spreadsheets
+  markdown  a table of prompts and commands, for documentation`,
+	Example: `  gencmd history export history.csv
+  gencmd history export --format markdown > commands.md`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runHistoryExport(cmd, args); err != nil {
+			fmt.Fprintf(cmd.OutOrStderr(), "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// historyImportCmd represents the history import command
+var historyImportCmd = &cobra.Command{
+	Use:   "import <file|->",
+	Short: "Import history entries",
+	Long: `Import history entries exported with "gencmd history export", from a file or
+from stdin with -. The formats are the same as export.
+
+Entries already in history are merged with the imported ones rather than
+duplicated, so importing the same file twice has no effect.`,
+	Example: `  gencmd history import history.jsonl
+  ssh server gencmd history export | gencmd history import -`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runHistoryImport(cmd, args[0]); err != nil {
+			fmt.Fprintf(cmd.OutOrStderr(), "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// historyStatsCmd represents the history stats command
+var historyStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show statistics about the history",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, _ []string) {
+		if err := runHistoryStats(cmd); err != nil {
+			fmt.Fprintf(cmd.OutOrStderr(), "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// historyImportShellCmd represents the history import-shell command
+var historyImportShellCmd = &cobra.Command{
+	Use:   "import-shell",
+	Short: "Import commands from the history of the shell",
+	Long: `Seed the history with commands from the history file of the shell.
+
+Bash (including timestamps from HISTTIMEFORMAT), zsh (plain and extended) and
+fish history files are supported. Only non-trivial commands are considered
+(e.g. cd and ls are skipped), without duplicates and without those that look
+like they contain secrets. The most frequently run commands come first.
+
+With --describe, the configured model writes a description of each command,
+which becomes its prompt. The commands are sent to the model in batches.
+
+Each command is then reviewed: described commands can be accepted, skipped or
+have their description edited, while for the others a description is asked.
+With --yes, all the described commands are imported without review.`,
+	Example: `  gencmd history import-shell --describe
+  gencmd history import-shell --shell zsh --file ~/.histfile --limit 50`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, _ []string) {
+		if err := runHistoryImportShell(cmd); err != nil {
+			fmt.Fprintf(cmd.OutOrStderr(), "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// historyMigrateCmd represents the history migrate command
+var historyMigrateCmd = &cobra.Command{
+	Use:   "migrate <jsonl|sqlite>",
+	Short: "Move the history to another store",
+	Long: `Copy the history and the rejected entries from the configured store to the
+given one, and set history.store in the configuration file to use it.
+
+The stores are:
+  jsonl   a plain file, appending an entry for every use (default)
+  sqlite  a database loading a single row per command, with a full-text
+          index for "gencmd history search"
+
+The destination store must be empty. The source store is left untouched, and
+can be deleted once the migration is done.`,
+	Example:   `  gencmd history migrate sqlite`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{ctrl.StoreJSONL, ctrl.StoreSQLite},
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runHistoryMigrate(cmd, args[0]); err != nil {
+			fmt.Fprintf(cmd.OutOrStderr(), "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// historySyncCmd represents the history sync command
+var historySyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Sync the history with other machines",
+	Long: `Merge the history with the one of the other machines sharing the sync
+directory, set with history.sync.dir in the configuration or with --dir.
+
+The directory can be shared through e.g. Syncthing or NFS, or be a clone of a
+git repository. In git repositories, the changes are committed, and pulled and
+pushed when the current branch has an upstream.
+
+Every machine writes its merged history and the entries deleted on it to
+files named after its hostname. Entries deleted on any machine are deleted
+everywhere, unless they were used again after being deleted. Syncing again
+without changes has no effect.`,
+	Example: `  gencmd history sync
+  gencmd history sync --dir ~/Sync/gencmd`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, _ []string) {
+		if err := runHistorySync(cmd); err != nil {
+			fmt.Fprintf(cmd.OutOrStderr(), "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// historyEncryptCmd represents the history encrypt command
+var historyEncryptCmd = &cobra.Command{
+	Use:   "encrypt",
+	Short: "Encrypt the existing history",
+	Long: `Encrypt all the entries of the history and of the rejected file, with the
+encryption set in history.encryption in the configuration.
+
+Once encryption is configured, new entries are encrypted, while the existing
+ones stay readable but unencrypted until this command is run.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, _ []string) {
+		if err := runHistoryEncrypt(cmd, true); err != nil {
+			fmt.Fprintf(cmd.OutOrStderr(), "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// historyDecryptCmd represents the history decrypt command
+var historyDecryptCmd = &cobra.Command{
+	Use:   "decrypt",
+	Short: "Decrypt the history",
+	Long: `Decrypt all the entries of the history and of the rejected file, with the
+encryption set in history.encryption in the configuration.
+
+Remove history.encryption from the configuration afterwards, or new entries
+are still encrypted.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, _ []string) {
+		if err := runHistoryEncrypt(cmd, false); err != nil {
+			fmt.Fprintf(cmd.OutOrStderr(), "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	historyCmd.AddCommand(historyListCmd)
+	historyCmd.AddCommand(historySearchCmd)
+	historyCmd.AddCommand(historyDeleteCmd)
+	historyCmd.AddCommand(historyEditCmd)
+	historyCmd.AddCommand(historyExportCmd)
+	historyCmd.AddCommand(historyImportCmd)
+	historyCmd.AddCommand(historyStatsCmd)
+	historyCmd.AddCommand(historyImportShellCmd)
+	historyCmd.AddCommand(historyMigrateCmd)
+	historyCmd.AddCommand(historySyncCmd)
+	historyCmd.AddCommand(historyEncryptCmd)
+	historyCmd.AddCommand(historyDecryptCmd)
+
+	for _, c := range []*cobra.Command{historyListCmd, historySearchCmd, historyStatsCmd} {
+		c.Flags().BoolVar(&historyJSON, "json", false, "Print JSON instead of text")
+	}
+	for _, c := range []*cobra.Command{historyListCmd, historySearchCmd} {
+		c.Flags().IntVarP(&historyLimit, "limit", "n", 0, "Maximum number of entries to print. Zero prints all of them.")
+	}
+	historyDeleteCmd.Flags().BoolVar(&historyAll, "all", false, "Delete all the entries matching the query")
+	historyDeleteCmd.Flags().BoolVarP(&historyYes, "yes", "y", false, "Delete the entries matching --all without confirmation")
+	historyEditCmd.Flags().StringVar(&historyPrompt, "prompt", "", "New prompt of the entry")
+	historyEditCmd.Flags().StringVar(&historyCommand, "command", "", "New command of the entry")
+	historyImportShellCmd.Flags().StringVar(&shellName, "shell", "", "Shell whose history to import (bash, zsh, fish). Defaults to the configured or detected shell.")
+	historyImportShellCmd.Flags().StringVar(&importFile, "file", "", "Path of the history file. Defaults to the one of the shell.")
+	historyImportShellCmd.Flags().IntVarP(&importLimit, "limit", "n", 100, "Maximum number of commands to import")
+	historyImportShellCmd.Flags().BoolVar(&importDescribe, "describe", false, "Ask the model to describe the commands")
+	historyImportShellCmd.Flags().IntVar(&importBatchSize, "batch-size", 20, "Number of commands described in a single request")
+	historyImportShellCmd.Flags().BoolVarP(&importYes, "yes", "y", false, "Import all the described commands without review")
+	historySyncCmd.Flags().StringVar(&syncDir, "dir", "", "Directory to sync through. Defaults to history.sync.dir in the configuration.")
+	for _, c := range []*cobra.Command{historyExportCmd, historyImportCmd} {
+		c.Flags().StringVarP(&historyFormat, "format", "f", "", "Format of the history: jsonl, csv or markdown. Defaults to the file extension, or jsonl.")
+	}
+}
+
+func newHistoryController() *ctrl.Controller {
+	cfg, _ := config.Load()
+	return ctrl.New(cfg)
+}
+
+// historyEntryJSON is a history entry with its ID.
+type historyEntryJSON struct {
+	ID string `json:"id"`
+	ctrl.HistoryEntry
+}
+
+func printHistory(w io.Writer, entries []ctrl.HistoryEntry) error {
+	if historyLimit > 0 && len(entries) > historyLimit {
+		entries = entries[:historyLimit]
+	}
+	if historyJSON {
+		res := make([]historyEntryJSON, len(entries))
+		for i, e := range entries {
+			res[i] = historyEntryJSON{ID: e.ID(), HistoryEntry: e}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tLAST USED\tUSES\tPROMPT\tCOMMAND")
+	for _, e := range entries {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n",
+			e.ID(), formatTimestamp(e.Timestamp), e.UseCount, e.Prompt,
+			strings.ReplaceAll(e.Command, "\n", " ⏎ "))
+	}
+	return tw.Flush()
+}
+
+func formatTimestamp(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+func runHistoryDelete(cmd *cobra.Command, args []string) error {
+	controller := newHistoryController()
+	query := strings.Join(args, " ")
+	var targets []ctrl.HistoryEntry
+	switch entry, ok := controller.FindHistory(args[0]); {
+	case ok && len(args) == 1:
+		targets = []ctrl.HistoryEntry{entry}
+	case historyAll:
+		// Fuzzy matches are too loose to delete all of them.
+		targets = controller.MatchHistory(query)
+	default:
+		targets = controller.SearchHistory(query)
+	}
+
+	switch {
+	case len(targets) == 0:
+		return fmt.Errorf("no history entries match %q", query)
+	case len(targets) > 1 && !historyAll:
+		historyJSON = false
+		if err := printHistory(cmd.OutOrStdout(), targets); err != nil {
+			return err
+		}
+		return fmt.Errorf("%d entries match, delete one by ID or use --all", len(targets))
+	case len(targets) > 1 && !historyYes:
+		historyJSON = false
+		if err := printHistory(cmd.OutOrStdout(), targets); err != nil {
+			return err
+		}
+		ok, err := ui.Confirm(fmt.Sprintf("Delete these %d entries?", len(targets)), cmd.InOrStdin(), cmd.ErrOrStderr())
+		if err != nil {
+			return err
+		}
+		if !ok {
+			cmd.PrintErrln("Nothing deleted")
+			return nil
+		}
+	}
+
+	for _, entry := range targets {
+		if err := controller.DeleteHistory(entry); err != nil {
+			return err
+		}
+		cmd.Printf("Deleted %s: %s\n", entry.ID(), entry.Prompt)
+	}
+	return nil
+}
+
+func runHistoryEdit(cmd *cobra.Command, id string) error {
+	controller := newHistoryController()
+	old, ok := controller.FindHistory(id)
+	if !ok {
+		return fmt.Errorf("no history entry with ID %q", id)
+	}
+
+	edited := old
+	if historyPrompt != "" {
+		edited.Prompt = historyPrompt
+	}
+	if historyCommand != "" {
+		edited.Command = historyCommand
+	}
+	if historyPrompt == "" && historyCommand == "" {
+		command, err := ui.EditText(old.Command)
+		if err != nil {
+			return err
+		}
+		edited.Command = command
+	}
+	if edited.Command == "" {
+		return fmt.Errorf("the command cannot be empty")
+	}
+	if edited.Prompt == old.Prompt && edited.Command == old.Command {
+		cmd.Println("No changes")
+		return nil
+	}
+
+	if err := controller.ReplaceHistory(old, edited); err != nil {
+		return err
+	}
+	cmd.Printf("Updated %s: %s\n", edited.ID(), edited.Command)
+	return nil
+}
+
+func runHistoryExport(cmd *cobra.Command, args []string) error {
+	controller := newHistoryController()
+	w := cmd.OutOrStdout()
+	var path string
+	if len(args) > 0 && args[0] != "-" {
+		path = args[0]
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	entries := controller.LoadHistory()
+	if err := ctrl.ExportHistory(w, historyFileFormat(path), entries); err != nil {
+		return fmt.Errorf("exporting history: %w", err)
+	}
+	if path != "" {
+		cmd.PrintErrf("Exported %d entries to %s\n", len(entries), path)
+	}
+	return nil
+}
+
+func runHistoryImport(cmd *cobra.Command, path string) error {
+	controller := newHistoryController()
+	r := cmd.InOrStdin()
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	entries, err := ctrl.ParseHistory(r, historyFileFormat(path))
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	stats, err := controller.ImportHistory(entries)
+	if err != nil {
+		return fmt.Errorf("importing history: %w", err)
+	}
+	cmd.Printf("Imported %d entries: %d added, %d merged, %d unchanged, %d ignored\n",
+		len(entries), stats.Added, stats.Merged, stats.Unchanged, stats.Ignored)
+	return nil
+}
+
+func runHistoryImportShell(cmd *cobra.Command) error {
+	if importYes && !importDescribe {
+		return fmt.Errorf("--yes requires --describe, as commands need a description")
+	}
+	cfg, err := config.Load()
+	if err != nil && importDescribe {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if err := applyShellFlag(&cfg); err != nil {
+		return err
+	}
+	controller := ctrl.New(cfg)
+	shell := controller.Shell()
+
+	path := importFile
+	if path == "" {
+		if path, err = ctrl.ShellHistoryPath(shell); err != nil {
+			return err
+		}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	all, err := ctrl.ParseShellHistory(f, shell)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	selected, err := controller.SelectShellCommands(all, importLimit)
+	if err != nil {
+		return err
+	}
+	if len(selected) == 0 {
+		cmd.PrintErrf("No commands worth importing found in %s\n", path)
+		return nil
+	}
+	cmd.PrintErrf("Found %d commands to import in %s\n", len(selected), path)
+
+	host, _ := os.Hostname()
+	entries := make([]ctrl.HistoryEntry, len(selected))
+	for i, c := range selected {
+		entries[i] = ctrl.HistoryEntry{
+			Command:   c.Command,
+			Timestamp: c.Timestamp,
+			Host:      host,
+			Shell:     string(shell),
+			Source:    ctrl.SourceShell,
+		}
+	}
+	if importDescribe {
+		if err := describeEntries(cmd, controller, entries); err != nil {
+			return err
+		}
+	}
+	if !importYes {
+		entries, err = ui.ReviewImports(entries, cmd.InOrStdin(), cmd.ErrOrStderr())
+		if err != nil {
+			return err
+		}
+	}
+
+	stats, err := controller.ImportHistory(entries)
+	if err != nil {
+		return fmt.Errorf("importing history: %w", err)
+	}
+	cmd.Printf("Imported %d commands: %d added, %d merged, %d unchanged, %d ignored\n",
+		len(entries), stats.Added, stats.Merged, stats.Unchanged, stats.Ignored)
+	return nil
+}
+
+// describeEntries sets the prompt of the entries to the description of their
+// command written by the model, in batches of importBatchSize.
+func describeEntries(cmd *cobra.Command, controller *ctrl.Controller, entries []ctrl.HistoryEntry) error {
+	size := max(importBatchSize, 1)
+	for start := 0; start < len(entries); start += size {
+		batch := entries[start:min(start+size, len(entries))]
+		cmd.PrintErrf("Describing commands %d-%d of %d...\n", start+1, start+len(batch), len(entries))
+		commands := make([]string, len(batch))
+		for i, e := range batch {
+			commands[i] = e.Command
+		}
+		descriptions, err := controller.DescribeCommands(commands)
+		if err != nil {
+			return err
+		}
+		for i := range batch {
+			batch[i].Prompt = strings.TrimSpace(descriptions[i])
+		}
+	}
+	return nil
+}
+
+// historyFileFormat returns the format given with --format or, if empty, the
+// one matching the extension of the path.
+func historyFileFormat(path string) string {
+	if historyFormat != "" {
+		return historyFormat
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return ctrl.FormatCSV
+	case ".md", ".markdown":
+		return ctrl.FormatMarkdown
+	default:
+		return ctrl.FormatJSONL
+	}
+}
+
+func runHistoryStats(cmd *cobra.Command) error {
+	stats := newHistoryController().HistoryStats()
+	w := cmd.OutOrStdout()
+	if historyJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(stats)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Entries:\t%d\n", stats.Entries)
+	fmt.Fprintf(tw, "Uses:\t%d\n", stats.Uses)
+	if stats.Runs > 0 {
+		fmt.Fprintf(tw, "Runs:\t%d (%d failed)\n", stats.Runs, stats.Failures)
+	}
+	if !stats.First.IsZero() {
+		fmt.Fprintf(tw, "First use:\t%s\n", formatTimestamp(stats.First))
+		fmt.Fprintf(tw, "Last use:\t%s\n", formatTimestamp(stats.Last))
+	}
+	for _, source := range []string{ctrl.SourceGenerated, ctrl.SourceHistory, ctrl.SourceEdited} {
+		if n := stats.Sources[source]; n > 0 {
+			fmt.Fprintf(tw, "Uses %s:\t%d\n", sourceLabels[source], n)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(stats.Models) > 0 {
+		fmt.Fprintln(w, "\nModels:")
+		tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		for _, c := range sortedCounts(stats.Models) {
+			fmt.Fprintf(tw, "  %s\t%d\n", c.Value, c.Count)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	if len(stats.TopCommands) > 0 {
+		fmt.Fprintln(w, "\nMost used commands:")
+		for _, e := range stats.TopCommands {
+			fmt.Fprintf(w, "  %4d  %s\n", e.UseCount, e.Command)
+		}
+	}
+	if len(stats.TopDirs) > 0 {
+		fmt.Fprintln(w, "\nMost used directories:")
+		for _, c := range stats.TopDirs {
+			fmt.Fprintf(w, "  %4d  %s\n", c.Count, c.Value)
+		}
+	}
+	return nil
+}
+
+func runHistoryMigrate(cmd *cobra.Command, to string) error {
+	if to != ctrl.StoreJSONL && to != ctrl.StoreSQLite {
+		return fmt.Errorf("unknown history store %q, expected %s or %s", to, ctrl.StoreJSONL, ctrl.StoreSQLite)
+	}
+	cfg, _ := config.Load()
+	from := cmp.Or(cfg.History.Store, ctrl.StoreJSONL)
+	if from == to {
+		return fmt.Errorf("the history is already in the %s store", to)
+	}
+
+	src, err := ctrl.OpenHistoryStore(cfg.History)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dstCfg := cfg.History
+	dstCfg.Store = to
+	dst, err := ctrl.OpenHistoryStore(dstCfg)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	if err := ctrl.CopyHistory(dst, src); err != nil {
+		return fmt.Errorf("migrating history: %w", err)
+	}
+
+	path := config.Path()
+	if err := config.Set(path, "history.store", to); err != nil {
+		return err
+	}
+	cmd.Printf("Migrated the history from %s to %s, and updated history.store in %s\n", from, to, path)
+	return nil
+}
+
+func runHistorySync(cmd *cobra.Command) error {
+	cfg, _ := config.Load()
+	dir := cmp.Or(syncDir, cfg.History.Sync.Dir)
+	if dir == "" {
+		return fmt.Errorf("no sync directory, set history.sync.dir in the configuration or use --dir")
+	}
+	dir, err := config.ExpandHome(dir)
+	if err != nil {
+		return err
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("getting hostname: %w", err)
+	}
+
+	stats, err := ctrl.New(cfg).SyncHistory(ctrl.SyncOptions{Dir: dir, Host: host})
+	if err != nil {
+		return fmt.Errorf("syncing history: %w", err)
+	}
+	for _, path := range stats.Skipped {
+		fmt.Fprintf(cmd.ErrOrStderr(), "WARNING: skipped %s: it can't be decrypted, use the same history.encryption settings on all machines\n", path)
+	}
+	cmd.Printf("Synced history with %s: %d added, %d merged, %d deleted\n",
+		dir, stats.Added, stats.Merged, stats.Deleted)
+	return nil
+}
+
+func runHistoryEncrypt(cmd *cobra.Command, encrypt bool) error {
+	n, err := newHistoryController().EncryptHistory(encrypt)
+	if err != nil {
+		return err
+	}
+	if encrypt {
+		cmd.Printf("Encrypted %d entries\n", n)
+	} else {
+		cmd.Printf("Decrypted %d entries\n", n)
+	}
+	return nil
+}
+
+var sourceLabels = map[string]string{
+	ctrl.SourceGenerated: "from generation",
+	ctrl.SourceHistory:   "from history",
+	ctrl.SourceEdited:    "after editing",
+}
+
+// sortedCounts returns the counts from the highest, breaking ties by value.
+func sortedCounts(counts map[string]int) []ctrl.Count {
+	var res []ctrl.Count
+	for v, n := range counts {
+		res = append(res, ctrl.Count{Value: v, Count: n})
+	}
+	slices.SortFunc(res, func(a, b ctrl.Count) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Value, b.Value)
+	})
+	return res
+}
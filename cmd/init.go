@@ -12,11 +12,25 @@ import (
 var reset bool
 
 const initMessage = `
-To enable key bindings, add the following line to your shell:
-source %s/key-bindings.bash 
+To enable key bindings, add the line for your shell to its configuration:
 
-(or, for zsh users):
-source %s/key-bindings.zsh
+bash (~/.bashrc):
+  source %[1]s/key-bindings.bash
+
+zsh (~/.zshrc):
+  source %[1]s/key-bindings.zsh
+
+fish (~/.config/fish/config.fish):
+  source %[1]s/key-bindings.fish
+
+nushell (~/.config/nushell/config.nu):
+  source %[1]s/key-bindings.nu
+
+PowerShell ($PROFILE):
+  . %[1]s/key-bindings.ps1
+
+To open gencmd in a popup with prefix + Ctrl+G inside tmux (~/.tmux.conf):
+  source-file %[1]s/key-bindings.tmux
 `
 
 // initCmd represents the init command
@@ -70,7 +84,7 @@ func runInit(cmd *cobra.Command) error {
 
 	cmd.Println("\nProvider configured successfully!")
 	printConfigPaths(cmd)
-	cmd.Printf(initMessage, config.Dir(), config.Dir())
+	cmd.Printf(initMessage, config.Dir())
 
 	return nil
 }
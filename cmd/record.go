@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mbrt/gencmd/config"
+	"github.com/mbrt/gencmd/ctrl"
+)
+
+var (
+	recordExitCode   int
+	recordDurationMs int64
+)
+
+// recordCmd represents the record command
+var recordCmd = &cobra.Command{
+	Use:   "record [flags] -- <command...>",
+	Short: "Record the outcome of a command selected with gencmd",
+	Long: `Record that a command selected with gencmd was executed, with its exit code and
+duration, in its history entry.
+
+This is meant to be called by the shell hooks in the key-bindings files, which
+are enabled by setting GENCMD_RECORD=1 before sourcing them.`,
+	Example: `  gencmd record --exit-code 0 --duration-ms 1200 -- ls -l`,
+	Args:    cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, _ := config.Load()
+		controller := ctrl.New(cfg)
+		command := strings.Join(args, " ")
+		duration := time.Duration(recordDurationMs) * time.Millisecond
+		if err := controller.RecordExecution(command, recordExitCode, duration); err != nil {
+			fmt.Fprintf(cmd.OutOrStderr(), "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(recordCmd)
+	recordCmd.Flags().IntVar(&recordExitCode, "exit-code", 0, "Exit code of the command")
+	recordCmd.Flags().Int64Var(&recordDurationMs, "duration-ms", 0, "Duration of the command, in milliseconds")
+}
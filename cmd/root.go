@@ -1,10 +1,14 @@
 package cmd
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"time"
 
+	"github.com/mattn/go-isatty"
 	"github.com/spf13/cobra"
 
 	"github.com/mbrt/gencmd/config"
@@ -12,7 +16,20 @@ import (
 	"github.com/mbrt/gencmd/ui"
 )
 
-var ttyPath string
+var (
+	ttyPath   string
+	shellName string
+	tmuxMode  bool
+	tmuxPane  string
+	uiHeight  string
+	ctxFile   string
+	outputTo  []string
+	incognito bool
+)
+
+// stdinTimeout bounds the wait for the first data piped into gencmd. Editors
+// and scripts may run it with a pipe as stdin that is never written to.
+const stdinTimeout = 3 * time.Second
 
 const missingCfgMsg = `WARNING: Error loading configuration: %v
 Please run "gencmd init" to create a default configuration.`
@@ -30,10 +47,38 @@ having access to a compatible LLM API, such as Google Gemini.`,
 		cfg, err := config.Load()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, missingCfgMsg, err)
+		} else {
+			warnInvalidConfig(cfg)
+		}
+		if err := applyShellFlag(&cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if uiHeight == "" {
+			uiHeight = cfg.UI.Height
 		}
-		// TODO: Add a fallback for when we don't have a terminal
-		err = ui.RunUI(ctrl.New(cfg), ui.Options{
-			TtyPath: ttyPath,
+		if len(outputTo) == 0 {
+			outputTo = cfg.UI.OutputTo
+		}
+		if err := ui.ValidateOutputTargets(outputTo); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		controller := ctrl.New(cfg)
+		// Stdin is used by the UI, so only the context file is considered.
+		sample, err := inputSample(false)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		controller.SetInputSample(sample)
+		controller.SetIncognito(incognito)
+		err = ui.RunUI(controller, ui.Options{
+			TtyPath:   ttyPath,
+			Height:    uiHeight,
+			Tmux:      tmuxOptions(cfg),
+			OutputTo:  outputTo,
+			Incognito: incognito,
 		})
 		if err != nil {
 			// Do not print the error if the user cancelled the operation.
@@ -56,4 +101,114 @@ func Execute() {
 
 func init() {
 	rootCmd.Flags().StringVar(&ttyPath, "tty", "", "Path to the TTY device to use. Defaults to the current terminal.")
+	rootCmd.Flags().StringVar(&uiHeight, "height", "", "Render inline below the prompt in the given lines or percentage of the terminal (e.g. 40%), instead of full screen.")
+	rootCmd.Flags().BoolVar(&tmuxMode, "tmux", false, "Open in a tmux popup and type the selection into the current pane.")
+	rootCmd.Flags().StringVar(&tmuxPane, "tmux-pane", "", "ID of the tmux pane to type the selection into, with --tmux. Defaults to the current pane.")
+	rootCmd.Flags().StringVar(&shellName, "shell", "", "Shell to generate commands for (bash, zsh, fish, nushell, pwsh). Defaults to the configured or detected shell.")
+	rootCmd.Flags().StringSliceVar(&outputTo, "output-to", nil, "Where to send the selected command: stdout, clipboard, osc52, or several separated by commas. Defaults to stdout.")
+	rootCmd.Flags().StringVar(&ctxFile, "context-file", "", "File whose content is the input of the commands. A sample of it is shown to the model.")
+	rootCmd.Flags().BoolVar(&incognito, "incognito", false, "Don't save the selected command in history.")
+}
+
+// applyShellFlag overrides the configured shell with the one given in the
+// --shell flag, if any.
+func applyShellFlag(cfg *config.Config) error {
+	if shellName == "" {
+		return nil
+	}
+	shell, err := ctrl.ParseShell(shellName)
+	if err != nil {
+		return err
+	}
+	cfg.Shell = string(shell)
+	return nil
+}
+
+// inputSample returns a sample of the input of the commands to generate,
+// from the file given with --context-file or, if readStdin is true, from the
+// data piped into gencmd. An empty sample is returned if there is no input.
+func inputSample(readStdin bool) (string, error) {
+	if ctxFile != "" {
+		f, err := os.Open(ctxFile)
+		if err != nil {
+			return "", fmt.Errorf("opening context file: %w", err)
+		}
+		defer f.Close()
+		return ctrl.InputSample(f)
+	}
+	if !readStdin {
+		return "", nil
+	}
+	// Only read from pipes and redirected files, which don't block forever
+	// waiting for input as a terminal would.
+	fi, err := os.Stdin.Stat()
+	if err != nil || (fi.Mode()&os.ModeNamedPipe == 0 && !fi.Mode().IsRegular()) {
+		return "", nil
+	}
+	if fi.Mode().IsRegular() {
+		return ctrl.InputSample(os.Stdin)
+	}
+	sample, ok, err := pipeSample(os.Stdin, stdinTimeout)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "WARNING: no data was piped into gencmd within %v, ignoring stdin (use --no-stdin to skip waiting)\n", stdinTimeout)
+	}
+	return sample, err
+}
+
+// pipeSample returns a sample of the data in the pipe, as ctrl.InputSample.
+// It returns false if no data arrives within the timeout.
+func pipeSample(r io.Reader, timeout time.Duration) (string, bool, error) {
+	br := bufio.NewReader(r)
+	ready := make(chan struct{})
+	go func() {
+		// Errors, like EOF, are returned again by the next read.
+		_, _ = br.Peek(1)
+		close(ready)
+	}()
+	select {
+	case <-ready:
+		sample, err := ctrl.InputSample(br)
+		return sample, true, err
+	case <-time.After(timeout):
+		return "", false, nil
+	}
+}
+
+// warnInvalidConfig prints the configuration validation errors as warnings,
+// without preventing gencmd from running.
+func warnInvalidConfig(cfg config.Config) {
+	errs, err := config.Validate(cfg.Path())
+	if err != nil {
+		return
+	}
+	for _, verr := range errs {
+		fmt.Fprintf(os.Stderr, "WARNING: %s: %v\n", cfg.Path(), verr)
+	}
+}
+
+// tmuxOptions returns the options to run the UI in a tmux popup, or nil if
+// the popup should not be used.
+//
+// The configured popup is only used when stdout is a terminal: the shell key
+// bindings read the selection from stdout, which stays empty when the popup
+// types it into the pane instead.
+func tmuxOptions(cfg config.Config) *ui.TmuxOptions {
+	tcfg := cfg.UI.Tmux
+	auto := tcfg.Popup && ui.InTmux() && isatty.IsTerminal(os.Stdout.Fd())
+	if !tmuxMode && !auto {
+		return nil
+	}
+	res := &ui.TmuxOptions{
+		Width:  tcfg.Width,
+		Height: tcfg.Height,
+		Pane:   tmuxPane,
+		Args:   os.Args[1:],
+	}
+	if res.Width == "" {
+		res.Width = "80%"
+	}
+	if res.Height == "" {
+		res.Height = "50%"
+	}
+	return res
 }
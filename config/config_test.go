@@ -67,6 +67,20 @@ func TestConfigLoad(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "gemini command env",
+			path: "testdata/empty.yaml",
+			env: map[string]string{
+				"GEMINI_API_KEY_COMMAND": "pass show gemini",
+			},
+			want: Config{
+				LLM: LLMConfig{
+					Provider:       "googleai",
+					ModelName:      "gemini-2.5-flash-lite",
+					PromptTemplate: defaultPromptTemplate,
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -196,3 +210,28 @@ func TestSetUnsetOption(t *testing.T) {
 		assert.Equal(t, []string{"FOO=bar"}, lines)
 	})
 }
+
+func TestSaveProviderEnv(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	xdg.Reload()
+	envPath, err := configPath(".env")
+	require.NoError(t, err)
+
+	// Start from a plaintext key.
+	err = SaveProviderEnv("googleai", map[string]string{"GEMINI_API_KEY": "xyz-123"})
+	require.NoError(t, err)
+	b, err := os.ReadFile(envPath)
+	require.NoError(t, err)
+	assert.Equal(t, `GEMINI_API_KEY="xyz-123"`, strings.TrimSpace(string(b)))
+
+	// Switching to a command comments out the plaintext key.
+	err = SaveProviderEnv("googleai", map[string]string{"GEMINI_API_KEY_COMMAND": "pass show gemini"})
+	require.NoError(t, err)
+	b, err = os.ReadFile(envPath)
+	require.NoError(t, err)
+	assert.Equal(t, "#GEMINI_API_KEY=\"xyz-123\"\nGEMINI_API_KEY_COMMAND=\"pass show gemini\"", strings.TrimSpace(string(b)))
+
+	// Neither the key nor the command.
+	err = SaveProviderEnv("googleai", map[string]string{})
+	assert.ErrorContains(t, err, "missing required environment variable: GEMINI_API_KEY")
+}
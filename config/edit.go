@@ -0,0 +1,219 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Get returns the value of the given dotted key (e.g. llm.modelName) in the
+// configuration. Scalars are returned as is, while mappings and sequences are
+// returned as YAML.
+func (c Config) Get(key string) (string, error) {
+	var root yaml.Node
+	if err := root.Encode(c); err != nil {
+		return "", fmt.Errorf("encoding configuration: %w", err)
+	}
+	_, n := findField(&root, key)
+	if n == nil {
+		return "", fmt.Errorf("key %q is not set", key)
+	}
+	if n.Kind == yaml.ScalarNode {
+		return n.Value, nil
+	}
+	b, err := yaml.Marshal(n)
+	if err != nil {
+		return "", fmt.Errorf("encoding %q: %w", key, err)
+	}
+	return strings.TrimSuffix(string(b), "\n"), nil
+}
+
+// Set changes the given dotted key (e.g. llm.modelName) in the configuration
+// file at path. The value is parsed as YAML, so that booleans, numbers and
+// lists keep their type.
+//
+// Comments, blank lines and the order of the existing keys are preserved. The resulting
+// file is validated against the configuration schema before being written.
+func Set(path, key, value string) error {
+	if key == "" {
+		return fmt.Errorf("empty key")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	out, err := setValue(data, key, value)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := os.WriteFile(path, out, 0o600); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
+
+func setValue(data []byte, key, value string) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	// The file may be empty or contain only comments (like the default
+	// configuration). In that case, keep its contents and append the new
+	// settings.
+	prefix := ""
+	if len(doc.Content) == 0 {
+		prefix = string(data)
+		if prefix != "" && !strings.HasSuffix(prefix, "\n") {
+			prefix += "\n"
+		}
+		doc = yaml.Node{
+			Kind:    yaml.DocumentNode,
+			Content: []*yaml.Node{{Kind: yaml.MappingNode}},
+		}
+	}
+
+	if err := setNode(doc.Content[0], strings.Split(key, "."), parseValue(value)); err != nil {
+		return nil, fmt.Errorf("setting %q: %w", key, err)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, fmt.Errorf("encoding configuration: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("encoding configuration: %w", err)
+	}
+	out := append([]byte(prefix), buf.Bytes()...)
+	if prefix == "" {
+		out = restoreBlankLines(data, out)
+	}
+
+	if _, _, errs := decodeStrict(out); len(errs) > 0 {
+		msgs := make([]string, len(errs))
+		for i, verr := range errs {
+			// Line numbers refer to the modified file, which the user
+			// never sees, so leave them out.
+			verr.Line = 0
+			msgs[i] = verr.Error()
+		}
+		return nil, fmt.Errorf("invalid value for %q: %s", key, strings.Join(msgs, "; "))
+	}
+	return out, nil
+}
+
+// restoreBlankLines adds back to the encoded YAML the blank lines of the
+// original, which the encoder drops. They go before the same lines they were
+// before in the original, matched by their longest common subsequence.
+func restoreBlankLines(original, encoded []byte) []byte {
+	var (
+		lines  []string // The non-blank lines of the original.
+		blanks []int    // The blank lines before each of them.
+		n      int
+	)
+	for _, l := range strings.Split(string(original), "\n") {
+		if strings.TrimSpace(l) == "" {
+			n++
+			continue
+		}
+		lines = append(lines, l)
+		blanks = append(blanks, n)
+		n = 0
+	}
+	out := strings.Split(strings.TrimSuffix(string(encoded), "\n"), "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of
+	// lines[i:] and out[j:].
+	lcs := make([][]int, len(lines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(out)+1)
+	}
+	for i := len(lines) - 1; i >= 0; i-- {
+		for j := len(out) - 1; j >= 0; j-- {
+			if lines[i] == out[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	i := 0
+	for j, l := range out {
+		for i < len(lines) && lines[i] != l && lcs[i+1][j] >= lcs[i][j+1] {
+			i++
+		}
+		if i < len(lines) && lines[i] == l {
+			buf.WriteString(strings.Repeat("\n", blanks[i]))
+			i++
+		}
+		buf.WriteString(l + "\n")
+	}
+	return buf.Bytes()
+}
+
+// parseValue converts the value given on the command line into a YAML node.
+// Booleans, numbers and flow sequences (e.g. [a, b]) keep their type, while
+// anything else is treated as a string.
+func parseValue(value string) *yaml.Node {
+	str := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+	if strings.Contains(value, "\n") {
+		str.Style = yaml.LiteralStyle
+		return str
+	}
+	var n yaml.Node
+	if err := yaml.Unmarshal([]byte(value), &n); err != nil || len(n.Content) == 0 {
+		return str
+	}
+	res := n.Content[0]
+	if (res.Kind == yaml.ScalarNode && res.Tag != "!!null") || res.Kind == yaml.SequenceNode {
+		return res
+	}
+	return str
+}
+
+// setNode sets the value at the given path under the mapping node, creating
+// intermediate mappings as needed.
+func setNode(n *yaml.Node, path []string, value *yaml.Node) error {
+	if n.Kind != yaml.MappingNode {
+		// A null value (e.g. "llm:" with nothing below) becomes a mapping.
+		if n.Kind != yaml.ScalarNode || n.Tag != "!!null" {
+			return fmt.Errorf("%q is not a mapping", n.Value)
+		}
+		n.Kind, n.Tag, n.Value = yaml.MappingNode, "", ""
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			// Keep the comments attached to the old value.
+			value.HeadComment = n.Content[i+1].HeadComment
+			value.LineComment = n.Content[i+1].LineComment
+			value.FootComment = n.Content[i+1].FootComment
+			n.Content[i+1] = value
+			return nil
+		}
+		return setNode(n.Content[i+1], path[1:], value)
+	}
+
+	keyNode := &yaml.Node{Kind: yaml.ScalarNode, Value: path[0]}
+	if len(path) == 1 {
+		n.Content = append(n.Content, keyNode, value)
+		return nil
+	}
+	child := &yaml.Node{Kind: yaml.MappingNode}
+	n.Content = append(n.Content, keyNode, child)
+	return setNode(child, path[1:], value)
+}
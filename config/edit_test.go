@@ -0,0 +1,167 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		key     string
+		value   string
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "preserve comments",
+			path:  "testdata/edit/commented.yaml",
+			key:   "llm.modelName",
+			value: "gemini-2.5-flash",
+			want: `# Settings for the model
+llm:
+  # Which provider to use
+  provider: googleai # fast and cheap
+  modelName: gemini-2.5-flash
+
+  openai:
+    baseUrl: https://api.openai.com/v1
+`,
+		},
+		{
+			name:  "new nested key",
+			path:  "testdata/edit/commented.yaml",
+			key:   "llm.openai.baseUrl",
+			value: "http://localhost:8080/v1",
+			want: `# Settings for the model
+llm:
+  # Which provider to use
+  provider: googleai # fast and cheap
+  modelName: gemini-2.5-flash-lite
+
+  openai:
+    baseUrl: http://localhost:8080/v1
+`,
+		},
+		{
+			name:  "new top-level key",
+			path:  "testdata/edit/commented.yaml",
+			key:   "shell",
+			value: "zsh",
+			want: `# Settings for the model
+llm:
+  # Which provider to use
+  provider: googleai # fast and cheap
+  modelName: gemini-2.5-flash-lite
+
+  openai:
+    baseUrl: https://api.openai.com/v1
+shell: zsh
+`,
+		},
+		{
+			name:  "null parent",
+			path:  "testdata/empty.yaml",
+			key:   "llm.provider",
+			value: "openai",
+			want: `llm:
+  provider: openai
+`,
+		},
+		{
+			name:  "template",
+			path:  "testdata/empty.yaml",
+			key:   "llm.promptTemplate",
+			value: "Generate commands for:\n{{.UserInput}}",
+			want: `llm:
+  promptTemplate: |-
+    Generate commands for:
+    {{.UserInput}}
+`,
+		},
+		{
+			name:    "invalid enum",
+			path:    "testdata/edit/commented.yaml",
+			key:     "llm.provider",
+			value:   "openia",
+			wantErr: "must be one of the following",
+		},
+		{
+			name:    "unknown key",
+			path:    "testdata/edit/commented.yaml",
+			key:     "llm.modelname",
+			value:   "gpt-4.1-mini",
+			wantErr: "field modelname not found",
+		},
+		{
+			name:    "not a mapping",
+			path:    "testdata/edit/commented.yaml",
+			key:     "llm.provider.name",
+			value:   "openai",
+			wantErr: "is not a mapping",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			b, err := os.ReadFile(tt.path)
+			require.NoError(t, err)
+			require.NoError(t, os.WriteFile(path, b, 0o600))
+
+			err = Set(path, tt.key, tt.value)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				// The file must be left untouched.
+				got, err := os.ReadFile(path)
+				require.NoError(t, err)
+				assert.Equal(t, string(b), string(got))
+				return
+			}
+			require.NoError(t, err)
+			got, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestSetCommentsOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, defaultConfigYaml, 0o600))
+
+	require.NoError(t, Set(path, "llm.modelName", "gpt-4.1-mini"))
+	got, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, string(defaultConfigYaml)+"llm:\n  modelName: gpt-4.1-mini\n", string(got))
+
+	cfg, err := LoadFrom(path)
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-4.1-mini", cfg.LLM.ModelName)
+}
+
+func TestGet(t *testing.T) {
+	cfg := Config{
+		LLM: LLMConfig{
+			Provider:  "openai",
+			ModelName: "gpt-4.1-mini",
+			OpenAI:    &OpenAIConfig{BaseURL: "http://localhost"},
+		},
+	}
+
+	got, err := cfg.Get("llm.modelName")
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-4.1-mini", got)
+
+	got, err = cfg.Get("llm.openai")
+	require.NoError(t, err)
+	assert.Equal(t, "baseUrl: http://localhost", got)
+
+	_, err = cfg.Get("llm.promptTemplate")
+	assert.ErrorContains(t, err, "not set")
+}
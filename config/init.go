@@ -17,6 +17,14 @@ var (
 	keyBindingsBash []byte
 	//go:embed key-bindings.zsh
 	keyBindingsZsh []byte
+	//go:embed key-bindings.fish
+	keyBindingsFish []byte
+	//go:embed key-bindings.nu
+	keyBindingsNu []byte
+	//go:embed key-bindings.ps1
+	keyBindingsPwsh []byte
+	//go:embed key-bindings.tmux
+	keyBindingsTmux []byte
 	//go:embed default-config.yaml
 	defaultConfigYaml []byte
 	//go:embed default-dotenv
@@ -32,6 +40,22 @@ var defaultConfigs = []configFile{
 		Name:    "key-bindings.zsh",
 		Content: keyBindingsZsh,
 	},
+	{
+		Name:    "key-bindings.fish",
+		Content: keyBindingsFish,
+	},
+	{
+		Name:    "key-bindings.nu",
+		Content: keyBindingsNu,
+	},
+	{
+		Name:    "key-bindings.ps1",
+		Content: keyBindingsPwsh,
+	},
+	{
+		Name:    "key-bindings.tmux",
+		Content: keyBindingsTmux,
+	},
 	{
 		Name:    "config.yaml",
 		Content: defaultConfigYaml,
@@ -89,6 +113,9 @@ func SaveProviderEnv(name string, env map[string]string) error {
 		// This ensures that only the relevant options are set.
 		for _, opt := range opts.Options {
 			unwantedOptions = append(unwantedOptions, opt.EnvVar)
+			if opt.Secret {
+				unwantedOptions = append(unwantedOptions, opt.CommandEnvVar())
+			}
 		}
 		for k := range opts.FixedEnv {
 			unwantedOptions = append(unwantedOptions, k)
@@ -100,9 +127,18 @@ func SaveProviderEnv(name string, env map[string]string) error {
 		return fmt.Errorf("unknown provider: %s", name)
 	}
 	for _, opt := range requiredOptions {
-		if val, ok := env[opt.EnvVar]; !ok || val == "" {
-			return fmt.Errorf("missing required environment variable: %s", opt.EnvVar)
+		if env[opt.EnvVar] != "" {
+			if opt.Secret {
+				// Only one way of providing the secret should be active.
+				unwantedOptions = append(unwantedOptions, opt.CommandEnvVar())
+			}
+			continue
+		}
+		if opt.Secret && env[opt.CommandEnvVar()] != "" {
+			unwantedOptions = append(unwantedOptions, opt.EnvVar)
+			continue
 		}
+		return fmt.Errorf("missing required environment variable: %s", opt.EnvVar)
 	}
 
 	// Load existing .env file contents
@@ -144,6 +180,7 @@ func ProvidersInitOptions() []ProviderDoc {
 					Name:        "Google Gemini API Key",
 					EnvVar:      "GEMINI_API_KEY",
 					Description: "API key for Google Gemini",
+					Secret:      true,
 				},
 			},
 		},
@@ -176,6 +213,7 @@ func ProvidersInitOptions() []ProviderDoc {
 					Name:        "OpenAI API Key",
 					EnvVar:      "OPENAI_API_KEY",
 					Description: "API key for OpenAI",
+					Secret:      true,
 				},
 			},
 		},
@@ -188,6 +226,7 @@ func ProvidersInitOptions() []ProviderDoc {
 					Name:        "Anthropic API Key",
 					EnvVar:      "ANTHROPIC_API_KEY",
 					Description: "API key for Anthropic",
+					Secret:      true,
 				},
 			},
 		},
@@ -219,6 +258,17 @@ type ProviderOption struct {
 	Name        string
 	EnvVar      string
 	Description string
+	// Secret options (e.g. API keys) can also be provided through a command
+	// printing their value, set in CommandEnvVar.
+	Secret bool
+}
+
+const commandEnvSuffix = "_COMMAND"
+
+// CommandEnvVar returns the environment variable holding the command that
+// prints the value of a secret option (e.g. GEMINI_API_KEY_COMMAND).
+func (o ProviderOption) CommandEnvVar() string {
+	return o.EnvVar + commandEnvSuffix
 }
 
 // CfgDir returns the configuration directory for gencmd.
@@ -226,6 +276,24 @@ func Dir() string {
 	return filepath.Join(xdg.ConfigHome, "gencmd")
 }
 
+// Path returns the path to the main configuration file.
+func Path() string {
+	return filepath.Join(Dir(), "config.yaml")
+}
+
+// ExpandHome replaces a leading "~" in the path with the home directory, as
+// paths in the configuration are not expanded by a shell.
+func ExpandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, path[1:]), nil
+}
+
 // ConfigPaths returns the paths to the configuration files.
 func ConfigPaths() []string {
 	var paths []string
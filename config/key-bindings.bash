@@ -3,10 +3,57 @@
 
 _gencmd_bind() {
     local gencmd_cmd="${GENCMD_CMD:-gencmd}"
-    local selection=$("$gencmd_cmd" --tty=/dev/tty)
+    local selection=$("$gencmd_cmd" --tty=/dev/tty --shell=bash "$@")
     READLINE_LINE="${READLINE_LINE:0:$READLINE_POINT}$selection${READLINE_LINE:$READLINE_POINT}"
     READLINE_POINT=$(( READLINE_POINT + ${#selection} ))
+    # Incognito commands are not recorded either.
+    [[ $1 == --incognito ]] || _gencmd_pending="$selection"
 }
 
-# Bind the command to Ctrl+G
+# Bind the command to Ctrl+G, and to Alt+G in incognito mode. Alt+G replaces
+# glob-complete-word: to keep it, set GENCMD_INCOGNITO_KEY before sourcing to
+# another key sequence (e.g. '\C-x\C-g'), or to an empty string to not bind
+# incognito mode.
 bind -x '"\C-g": "_gencmd_bind"'
+_gencmd_key=${GENCMD_INCOGNITO_KEY-'\eg'}
+[[ -z $_gencmd_key ]] || bind -x "\"$_gencmd_key\": \"_gencmd_bind --incognito\""
+unset _gencmd_key
+
+# Record the exit code and duration of the selected commands, when they are
+# executed unchanged. Enable by setting GENCMD_RECORD=1 before sourcing.
+[[ ${GENCMD_RECORD:-0} == 1 ]] || return 0
+
+_gencmd_preexec() {
+    [[ -n $_gencmd_pending && $BASH_COMMAND != _gencmd_precmd* ]] || return 0
+    local line
+    line=$(HISTTIMEFORMAT= builtin history 1)
+    [[ $line =~ ^\ *[0-9]+\*?\ +(.*)$ ]] && line="${BASH_REMATCH[1]}"
+    if [[ $line == "$_gencmd_pending" ]]; then
+        _gencmd_running="$line"
+        _gencmd_start="${EPOCHREALTIME/[.,]/}"
+    fi
+    _gencmd_pending=
+    return 0
+}
+
+_gencmd_precmd() {
+    local ret=$?
+    if [[ -n $_gencmd_running ]]; then
+        local duration=0
+        if [[ -n $_gencmd_start ]]; then
+            duration=$(( (${EPOCHREALTIME/[.,]/} - _gencmd_start) / 1000 ))
+        fi
+        ("${GENCMD_CMD:-gencmd}" record --exit-code "$ret" --duration-ms "$duration" -- "$_gencmd_running" &>/dev/null &)
+        _gencmd_running=
+    fi
+    return $ret
+}
+
+if declare -p preexec_functions &>/dev/null; then
+    # bash-preexec is installed.
+    preexec_functions+=(_gencmd_preexec)
+    precmd_functions=(_gencmd_precmd "${precmd_functions[@]}")
+elif [[ -z $(trap -p DEBUG) ]]; then
+    trap '_gencmd_preexec' DEBUG
+    PROMPT_COMMAND="_gencmd_precmd${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+fi
@@ -0,0 +1,49 @@
+status is-interactive; or exit 0
+
+
+function _gencmd_widget
+    set -l gencmd_cmd gencmd
+    set -q GENCMD_CMD; and set gencmd_cmd $GENCMD_CMD
+    set -l selection ($gencmd_cmd --tty=/dev/tty --shell=fish $argv | string collect)
+    if test -n "$selection"
+        commandline -i -- $selection
+        # Incognito commands are not recorded either.
+        contains -- --incognito $argv; or set -g _gencmd_pending $selection
+    end
+    commandline -f repaint
+end
+
+# Bind the command to Ctrl+G, and to Alt+G in incognito mode. To bind
+# incognito mode to another key, set GENCMD_INCOGNITO_KEY before sourcing
+# (e.g. to \cx\cg), or to an empty string to not bind it.
+bind \cg _gencmd_widget
+bind -M insert \cg _gencmd_widget 2>/dev/null
+set -l gencmd_key \eg
+set -q GENCMD_INCOGNITO_KEY; and set gencmd_key $GENCMD_INCOGNITO_KEY
+if test -n "$gencmd_key"
+    bind $gencmd_key '_gencmd_widget --incognito'
+    bind -M insert $gencmd_key '_gencmd_widget --incognito' 2>/dev/null
+end
+
+# Record the exit code and duration of the selected commands, when they are
+# executed unchanged. Enable by setting GENCMD_RECORD=1 before sourcing.
+test "$GENCMD_RECORD" = 1; or exit 0
+
+function _gencmd_preexec --on-event fish_preexec
+    set -g _gencmd_running
+    if test -n "$_gencmd_pending"; and test "$argv[1]" = "$_gencmd_pending"
+        set -g _gencmd_running $argv[1]
+    end
+    set -g _gencmd_pending
+end
+
+function _gencmd_postexec --on-event fish_postexec
+    set -l ret $status
+    if test -n "$_gencmd_running"
+        set -l gencmd_cmd gencmd
+        set -q GENCMD_CMD; and set gencmd_cmd $GENCMD_CMD
+        $gencmd_cmd record --exit-code $ret --duration-ms $CMD_DURATION -- $_gencmd_running &>/dev/null &
+        disown 2>/dev/null
+    end
+    set -g _gencmd_running
+end
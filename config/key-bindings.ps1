@@ -0,0 +1,21 @@
+if (-not (Get-Module -Name PSReadLine)) { return }
+
+
+# Bind the command to Ctrl+G, and to Alt+G in incognito mode. Change the
+# chord of gencmd-incognito to use another key.
+Set-PSReadLineKeyHandler -Chord 'Ctrl+g' -BriefDescription 'gencmd' -Description 'Generate a command with gencmd' -ScriptBlock {
+    $gencmdCmd = if ($env:GENCMD_CMD) { $env:GENCMD_CMD } else { 'gencmd' }
+    $selection = & $gencmdCmd --tty=/dev/tty --shell=pwsh
+    if ($LASTEXITCODE -eq 0 -and $selection) {
+        [Microsoft.PowerShell.PSConsoleReadLine]::Insert(($selection -join "`n"))
+    }
+    [Microsoft.PowerShell.PSConsoleReadLine]::InvokePrompt()
+}
+Set-PSReadLineKeyHandler -Chord 'Alt+g' -BriefDescription 'gencmd-incognito' -Description 'Generate a command with gencmd, without saving it in history' -ScriptBlock {
+    $gencmdCmd = if ($env:GENCMD_CMD) { $env:GENCMD_CMD } else { 'gencmd' }
+    $selection = & $gencmdCmd --tty=/dev/tty --shell=pwsh --incognito
+    if ($LASTEXITCODE -eq 0 -and $selection) {
+        [Microsoft.PowerShell.PSConsoleReadLine]::Insert(($selection -join "`n"))
+    }
+    [Microsoft.PowerShell.PSConsoleReadLine]::InvokePrompt()
+}
@@ -0,0 +1,239 @@
+package config
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/xeipuuv/gojsonschema"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed config-schema.json
+var configSchema []byte
+
+var (
+	yamlLineRe     = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+	templateLineRe = regexp.MustCompile(`template: prompt:(\d+):`)
+)
+
+// ValidationError describes a single problem found in a configuration file.
+type ValidationError struct {
+	// Line is the 1-based line in the file, or 0 when unknown.
+	Line int
+	// Field is the dotted path of the offending field (e.g. llm.provider).
+	Field   string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	var b strings.Builder
+	if e.Line > 0 {
+		fmt.Fprintf(&b, "line %d: ", e.Line)
+	}
+	if e.Field != "" {
+		fmt.Fprintf(&b, "%s: ", e.Field)
+	}
+	b.WriteString(e.Message)
+	return b.String()
+}
+
+// Validate strictly checks the configuration file at the given path.
+//
+// Unlike LoadFrom, unknown fields are reported, the file is validated against
+// the configuration JSON schema and the resulting configuration is checked
+// for missing settings and invalid prompt templates. The returned error is
+// only set when the file cannot be read.
+func Validate(path string) ([]ValidationError, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return validateBytes(data), nil
+}
+
+func validateBytes(data []byte) []ValidationError {
+	root, cfg, errs := decodeStrict(data)
+	if len(errs) > 0 {
+		return errs
+	}
+	return validateConfig(root, cfg)
+}
+
+// decodeStrict parses the configuration, rejecting unknown fields and values
+// not allowed by the schema.
+func decodeStrict(data []byte) (*yaml.Node, Config, []ValidationError) {
+	var root yaml.Node
+	cfg := DefaultFromEnv()
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return &root, cfg, yamlErrors(err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return &root, cfg, yamlErrors(err)
+	}
+	return &root, cfg, validateSchema(&root)
+}
+
+func validateSchema(root *yaml.Node) []ValidationError {
+	var doc any
+	if err := root.Decode(&doc); err != nil {
+		return yamlErrors(err)
+	}
+	doc = dropNulls(doc)
+	if doc == nil {
+		// An empty document (e.g. only comments) is valid.
+		doc = map[string]any{}
+	}
+
+	res, err := gojsonschema.Validate(
+		gojsonschema.NewBytesLoader(configSchema),
+		gojsonschema.NewGoLoader(doc),
+	)
+	if err != nil {
+		return []ValidationError{{Message: fmt.Sprintf("validating schema: %v", err)}}
+	}
+
+	var errs []ValidationError
+	for _, re := range res.Errors() {
+		field := re.Field()
+		if field == gojsonschema.STRING_ROOT_SCHEMA_PROPERTY {
+			field = ""
+		}
+		errs = append(errs, ValidationError{
+			Line:  fieldLine(root, field),
+			Field: field,
+			// Some descriptions repeat the field name.
+			Message: strings.TrimPrefix(re.Description(), field+" "),
+		})
+	}
+	return errs
+}
+
+func validateConfig(root *yaml.Node, cfg Config) []ValidationError {
+	var errs []ValidationError
+	if cfg.LLM.Provider == "" {
+		errs = append(errs, ValidationError{
+			Line:    fieldLine(root, "llm"),
+			Field:   "llm.provider",
+			Message: "no provider configured and none detected from the environment",
+		})
+	} else if cfg.LLM.ModelName == "" {
+		errs = append(errs, ValidationError{
+			Line:    fieldLine(root, "llm.provider"),
+			Field:   "llm.modelName",
+			Message: "model name is required",
+		})
+	}
+	if _, err := template.New("prompt").Parse(cfg.LLM.PromptTemplate); err != nil {
+		errs = append(errs, ValidationError{
+			Line:    templateErrorLine(root, "llm.promptTemplate", err),
+			Field:   "llm.promptTemplate",
+			Message: fmt.Sprintf("invalid template: %v", err),
+		})
+	}
+	return errs
+}
+
+// dropNulls removes null values from mappings, as YAML treats them the same
+// as unset fields.
+func dropNulls(v any) any {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return v
+	}
+	for k, val := range m {
+		if val == nil {
+			delete(m, k)
+			continue
+		}
+		m[k] = dropNulls(val)
+	}
+	return m
+}
+
+// yamlErrors converts YAML syntax and decoding errors into validation errors,
+// extracting line numbers when available.
+func yamlErrors(err error) []ValidationError {
+	var msgs []string
+	var terr *yaml.TypeError
+	if errors.As(err, &terr) {
+		msgs = terr.Errors
+	} else {
+		msgs = []string{err.Error()}
+	}
+
+	res := make([]ValidationError, 0, len(msgs))
+	for _, msg := range msgs {
+		verr := ValidationError{Message: strings.TrimPrefix(msg, "yaml: ")}
+		if m := yamlLineRe.FindStringSubmatch(msg); m != nil {
+			verr.Line, _ = strconv.Atoi(m[1])
+			verr.Message = m[2]
+		}
+		res = append(res, verr)
+	}
+	return res
+}
+
+// fieldLine returns the line of the deepest existing key along the given
+// dotted path, or 0 if the document is empty.
+func fieldLine(root *yaml.Node, field string) int {
+	line, _ := findField(root, field)
+	return line
+}
+
+// findField walks the given dotted path and returns the line of the deepest
+// existing key, together with the value node if the whole path exists.
+func findField(root *yaml.Node, field string) (int, *yaml.Node) {
+	n := root
+	if n.Kind == yaml.DocumentNode && len(n.Content) > 0 {
+		n = n.Content[0]
+	}
+	line := n.Line
+	if field == "" {
+		return line, n
+	}
+	for _, name := range strings.Split(field, ".") {
+		if n.Kind != yaml.MappingNode {
+			return line, nil
+		}
+		var next *yaml.Node
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == name {
+				line = n.Content[i].Line
+				next = n.Content[i+1]
+				break
+			}
+		}
+		if next == nil {
+			return line, nil
+		}
+		n = next
+	}
+	return line, n
+}
+
+// templateErrorLine maps a template parsing error to the line in the file,
+// taking into account where the template starts.
+func templateErrorLine(root *yaml.Node, field string, err error) int {
+	line, value := findField(root, field)
+	m := templateLineRe.FindStringSubmatch(err.Error())
+	if value == nil || m == nil {
+		return line
+	}
+	tline, _ := strconv.Atoi(m[1])
+	if value.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+		// Block scalars start on the line after the indicator.
+		return value.Line + tline
+	}
+	return value.Line + tline - 1
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		env  map[string]string
+		want []ValidationError
+	}{
+		{
+			name: "valid",
+			path: "testdata/openai.yaml",
+			env: map[string]string{
+				"OPENAI_API_KEY": "xyz-123",
+			},
+		},
+		{
+			name: "only comments",
+			path: "default-config.yaml",
+			env: map[string]string{
+				"GEMINI_API_KEY": "xyz-123",
+			},
+		},
+		{
+			name: "unknown field",
+			path: "testdata/invalid/unknown-field.yaml",
+			want: []ValidationError{
+				{Line: 3, Message: "field modelname not found in type config.LLMConfig"},
+			},
+		},
+		{
+			name: "bad provider",
+			path: "testdata/invalid/bad-provider.yaml",
+			want: []ValidationError{
+				{
+					Line:    3,
+					Field:   "llm.provider",
+					Message: `must be one of the following: "googleai", "vertexai", "openai", "anthropic", "ollama"`,
+				},
+			},
+		},
+		{
+			name: "bad template",
+			path: "testdata/invalid/bad-template.yaml",
+			want: []ValidationError{
+				{
+					Line:    6,
+					Field:   "llm.promptTemplate",
+					Message: "invalid template: template: prompt:2: unclosed action started at prompt:1",
+				},
+			},
+		},
+		{
+			name: "missing provider",
+			path: "testdata/override.yaml",
+			want: []ValidationError{
+				{
+					Line:    1,
+					Field:   "llm.provider",
+					Message: "no provider configured and none detected from the environment",
+				},
+			},
+		},
+		{
+			name: "syntax error",
+			path: "testdata/invalid/syntax.yaml",
+			want: []ValidationError{
+				{Line: 1, Message: "did not find expected ',' or ']'"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearProviderEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			got, err := Validate(tt.path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestValidationErrorString(t *testing.T) {
+	err := ValidationError{Line: 3, Field: "llm.provider", Message: "bad value"}
+	assert.Equal(t, "line 3: llm.provider: bad value", err.Error())
+	err = ValidationError{Message: "bad value"}
+	assert.Equal(t, "bad value", err.Error())
+}
+
+// clearProviderEnv unsets the variables used to detect the provider, so that
+// tests are not affected by the environment they run in.
+func clearProviderEnv(t *testing.T) {
+	t.Helper()
+	for _, p := range ProvidersInitOptions() {
+		for _, opt := range p.Options {
+			t.Setenv(opt.EnvVar, "")
+			os.Unsetenv(opt.EnvVar)
+		}
+		for k := range p.FixedEnv {
+			t.Setenv(k, "")
+			os.Unsetenv(k)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package ctrl
+
+import (
+	"fmt"
+	"time"
+)
+
+// BatchOptions configure the generation of commands for many prompts.
+type BatchOptions struct {
+	// Concurrency is the maximum number of generations in flight.
+	Concurrency int
+	// Retries is the number of times a failed generation is retried.
+	Retries int
+	// RetryDelay is the delay before the first retry. It doubles at every
+	// following attempt.
+	RetryDelay time.Duration
+}
+
+// BatchResult is the result of generating commands for one of the prompts of
+// a batch.
+type BatchResult struct {
+	Generation
+	Err error
+}
+
+// GenerateBatch generates commands for all the prompts, with bounded
+// concurrency and retries. Results are sent to the returned channel in the
+// same order as the prompts, as soon as they are available. The channel is
+// closed after the last result.
+func (c *Controller) GenerateBatch(prompts []string, opts BatchOptions) <-chan BatchResult {
+	return generateBatch(prompts, opts, c.Generate)
+}
+
+func generateBatch(prompts []string, opts BatchOptions, generate func(string) (Generation, error)) <-chan BatchResult {
+	concurrency := max(opts.Concurrency, 1)
+	sem := make(chan struct{}, concurrency)
+	pending := make([]chan BatchResult, len(prompts))
+
+	for i, prompt := range prompts {
+		pending[i] = make(chan BatchResult, 1)
+		go func() {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			pending[i] <- generateWithRetry(prompt, opts, generate)
+		}()
+	}
+
+	res := make(chan BatchResult)
+	go func() {
+		defer close(res)
+		for _, p := range pending {
+			res <- <-p
+		}
+	}()
+	return res
+}
+
+func generateWithRetry(prompt string, opts BatchOptions, generate func(string) (Generation, error)) BatchResult {
+	delay := opts.RetryDelay
+	for attempt := 0; ; attempt++ {
+		gen, err := generate(prompt)
+		if err == nil {
+			return BatchResult{Generation: gen}
+		}
+		if attempt >= opts.Retries {
+			if attempt > 0 {
+				err = fmt.Errorf("after %d attempts: %w", attempt+1, err)
+			}
+			return BatchResult{Generation: Generation{Prompt: prompt}, Err: err}
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
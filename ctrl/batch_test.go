@@ -0,0 +1,77 @@
+package ctrl
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateBatch(t *testing.T) {
+	prompts := []string{"p0", "p1", "p2", "p3", "p4", "p5"}
+
+	var (
+		inFlight    atomic.Int32
+		maxInFlight atomic.Int32
+		mu          sync.Mutex
+		attempts    = make(map[string]int)
+	)
+	generate := func(prompt string) (Generation, error) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+
+		mu.Lock()
+		attempts[prompt]++
+		attempt := attempts[prompt]
+		mu.Unlock()
+
+		switch prompt {
+		case "p0":
+			// Finish last, to check the results are in order anyway.
+			time.Sleep(20 * time.Millisecond)
+		case "p2":
+			// Fail once.
+			if attempt == 1 {
+				return Generation{}, errors.New("transient")
+			}
+		case "p4":
+			return Generation{}, errors.New("permanent")
+		}
+		return Generation{
+			Prompt:   prompt,
+			Commands: []GeneratedCommand{{Command: "cmd-" + prompt}},
+		}, nil
+	}
+
+	opts := BatchOptions{Concurrency: 2, Retries: 1}
+	var got []string
+	for res := range generateBatch(prompts, opts, generate) {
+		if res.Err != nil {
+			got = append(got, fmt.Sprintf("%s: %v", res.Prompt, res.Err))
+			continue
+		}
+		got = append(got, res.Commands[0].Command)
+	}
+
+	assert.Equal(t, []string{
+		"cmd-p0",
+		"cmd-p1",
+		"cmd-p2",
+		"cmd-p3",
+		"p4: after 2 attempts: permanent",
+		"cmd-p5",
+	}, got)
+	assert.LessOrEqual(t, maxInFlight.Load(), int32(2))
+	assert.Equal(t, 2, attempts["p2"])
+	assert.Equal(t, 2, attempts["p4"])
+}
@@ -1,185 +1,652 @@
 package ctrl
 
 import (
-	"bufio"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
 	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/adrg/xdg"
+	"github.com/sahilm/fuzzy"
 
 	"github.com/mbrt/gencmd/config"
 )
 
+// ErrNotInHistory is returned when recording the execution of a command that
+// is not in history.
+var ErrNotInHistory = errors.New("command not found in history")
+
 func New(cfg config.Config) *Controller {
-	hpath, _ := xdg.DataFile("gencmd/history.jsonl")
-	rpath, _ := xdg.DataFile("gencmd/rejected.jsonl")
+	shell, err := ParseShell(cfg.Shell)
+	if err != nil {
+		shell = DetectShell()
+	}
 	return &Controller{
-		historyPath:  hpath,
-		rejectedPath: rpath,
-		cfg:          cfg,
+		cfg:   cfg,
+		shell: shell,
 	}
 }
 
 type Controller struct {
-	historyPath  string
-	rejectedPath string
-	cfg          config.Config
+	cfg         config.Config
+	shell       Shell
+	inputSample string
+	incognito   bool
+
+	storeOnce sync.Once
+	store     HistoryStore
+	storeErr  error
+
+	modelOnce sync.Once
+	model     Model
+	modelErr  error
+
+	redactorOnce sync.Once
+	redactor     *redactor
+	redactorErr  error
+
+	filterOnce sync.Once
+	filter     *historyFilter
+	filterErr  error
+
+	cacheMu sync.Mutex
+	cache   map[string]Generation
+}
+
+// Shell returns the shell commands are generated for.
+func (c *Controller) Shell() Shell {
+	return c.shell
 }
 
+// LoadHistory returns the history without duplicates, ranked according to the
+// configuration.
 func (c *Controller) LoadHistory() []HistoryEntry {
-	entries := c.loadHistoryRaw()
+	result := c.loadDistinctHistory()
 
-	// Reverse the order to have the most recent entries first.
-	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
-		entries[i], entries[j] = entries[j], entries[i]
-	}
-	// Remove duplicates, keeping the most recent entry.
-	seen := make(map[HistoryEntry]bool)
-	var result []HistoryEntry
-	for _, entry := range entries {
-		if !seen[entry] {
-			result = append(result, entry)
-			seen[entry] = true
+	if c.cfg.History.Ranking != RankingRecency {
+		boost := c.cfg.History.DirectoryBoost
+		if boost == 0 {
+			boost = defaultDirectoryBoost
 		}
+		dir, _ := os.Getwd()
+		rankFrecency(result, time.Now(), dir, boost)
 	}
-
 	return result
 }
 
-func (c *Controller) UpdateHistory(prompt, command string) error {
-	if c.historyPath == "" {
-		return fmt.Errorf("history path is not set")
+// UpdateHistory records the use of the command, obtained from source (e.g.
+// SourceGenerated), together with details about where it was used. Secrets
+// in the prompt and the command are replaced with placeholders. Nothing is
+// recorded in incognito mode, or when the ignore rules of the configuration
+// match.
+func (c *Controller) UpdateHistory(prompt, command, source string) error {
+	if c.incognito {
+		return nil
+	}
+	dir, _ := os.Getwd()
+	if ignored, err := c.ignoresHistory(prompt, command, dir); err != nil || ignored {
+		return err
 	}
-	file, err := os.OpenFile(c.historyPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	r, err := c.getRedactor()
 	if err != nil {
-		return fmt.Errorf("opening history file: %w", err)
+		return err
 	}
-	defer file.Close()
-
-	entry := HistoryEntry{Prompt: prompt, Command: command}
-	data, err := json.Marshal(entry)
+	prompt, command = r.redactEntry(prompt, command)
+	store, unlock, err := c.lockHistory()
 	if err != nil {
-		return fmt.Errorf("marshalling history entry: %w", err)
+		return err
+	}
+	defer unlock()
+	return store.Append(c.newHistoryEntry(prompt, command, source))
+}
+
+// newHistoryEntry returns an entry for a single use of the command, with the
+// details of the current environment.
+func (c *Controller) newHistoryEntry(prompt, command, source string) HistoryEntry {
+	entry := HistoryEntry{
+		Version:   historyVersion,
+		Prompt:    prompt,
+		Command:   command,
+		Timestamp: time.Now().UTC().Truncate(time.Second),
+		Shell:     string(c.shell),
+		Source:    source,
+		UseCount:  1,
 	}
-	if _, err := file.WriteString(string(data) + "\n"); err != nil {
-		return fmt.Errorf("writing to history file: %w", err)
+	entry.Dir, _ = os.Getwd()
+	entry.Host, _ = os.Hostname()
+	if source != SourceHistory {
+		entry.Provider = c.cfg.LLM.Provider
+		entry.Model = c.cfg.LLM.ModelName
 	}
-	return nil
+	return entry
 }
 
+// DeleteHistory removes all the instances of the entry from history, and logs
+// it as rejected.
 func (c *Controller) DeleteHistory(entry HistoryEntry) error {
-	if c.historyPath == "" || c.rejectedPath == "" {
-		return fmt.Errorf("history or rejected paths not set")
+	store, unlock, err := c.lockHistory()
+	if err != nil {
+		return err
 	}
+	defer unlock()
 
-	// First, log the deleted entry to rejected.jsonl
-	if err := c.logRejected(entry); err != nil {
+	// First, log the deleted entry as rejected
+	entry.RejectedAt = time.Now().UTC().Truncate(time.Second)
+	if err := store.Reject(entry); err != nil {
 		return fmt.Errorf("logging rejected entry: %w", err)
 	}
+	return store.Delete(entry)
+}
+
+// ReplaceHistory replaces all the instances of the old entry with the edited
+// one, which becomes the most recent. Unlike DeleteHistory, the old entry is
+// not logged as rejected. Secrets are redacted as in UpdateHistory. History
+// is left untouched in incognito mode, while edited entries matching the
+// ignore rules only remove the old one.
+func (c *Controller) ReplaceHistory(old, edited HistoryEntry) error {
+	if c.incognito {
+		return nil
+	}
+	dir, _ := os.Getwd()
+	ignored, err := c.ignoresHistory(edited.Prompt, edited.Command, dir)
+	if err != nil {
+		return err
+	}
+	r, err := c.getRedactor()
+	if err != nil {
+		return err
+	}
+	prompt, command := r.redactEntry(edited.Prompt, edited.Command)
+	store, unlock, err := c.lockHistory()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
-	// Read current history (if file exists)
-	entries := c.loadHistoryRaw()
-	if len(entries) == 0 {
+	if err := store.Delete(old); err != nil {
+		return err
+	}
+	if ignored {
 		return nil
 	}
+	return store.Append(c.newHistoryEntry(prompt, command, SourceEdited))
+}
+
+// RecordExecution records that the command was executed, with the given exit
+// code and duration, in the most recent history entry for it. Commands with
+// filled in placeholders match the entry with the placeholders. It returns
+// ErrNotInHistory if no entry matches.
+func (c *Controller) RecordExecution(command string, exitCode int, duration time.Duration) error {
+	store, unlock, err := c.lockHistory()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
-	// Remove all instances of the entry
-	entries = slices.DeleteFunc(entries, func(e HistoryEntry) bool {
-		return e == entry
+	entries, _ := c.loadHistoryRaw()
+	i := lastIndexFunc(entries, func(e HistoryEntry) bool {
+		return e.Command == command
 	})
+	if i < 0 {
+		i = lastIndexFunc(entries, func(e HistoryEntry) bool {
+			return matchesTemplate(e.Command, command)
+		})
+	}
+	if i < 0 {
+		return ErrNotInHistory
+	}
 
-	// Rewrite history file
-	return c.rewriteHistory(entries)
+	e := entries[i]
+	e.Runs++
+	if exitCode != 0 {
+		e.Failures++
+	}
+	e.LastExitCode = exitCode
+	e.LastDurationMs = duration.Milliseconds()
+	return store.UpdateLast(e)
 }
 
-func (c *Controller) GenerateCommands(prompt string) ([]string, error) {
-	ctx := context.Background()
-	model, err := NewModel(ctx, c.cfg.LLM)
-	if err != nil {
-		return nil, fmt.Errorf("creating model: %w", err)
+// SearchHistory returns the history entries matching the query, best matches
+// first. Stores with a full-text index (e.g. StoreSQLite) match the words of
+// the query through it, while the others, or when nothing matches, fall back
+// to fuzzy matching, as in the interactive UI.
+func (c *Controller) SearchHistory(query string) []HistoryEntry {
+	history := c.LoadHistory()
+	if res, _ := c.searchIndex(query, history); len(res) > 0 {
+		return res
+	}
+	targets := make([]string, len(history))
+	for i, entry := range history {
+		targets[i] = entry.Prompt + " " + entry.Command
 	}
-	return model.GenerateCommands(ctx, prompt)
+	matches := fuzzy.Find(query, targets)
+	sort.Stable(matches)
+
+	res := make([]HistoryEntry, len(matches))
+	for i, m := range matches {
+		res[i] = history[m.Index]
+	}
+	return res
 }
 
-func (c *Controller) loadHistoryRaw() []HistoryEntry {
-	if c.historyPath == "" {
-		return nil
+// MatchHistory returns the history entries matching every word of the query,
+// without the fuzzy fallback of SearchHistory, for changes that shouldn't
+// touch loose matches. Stores with a full-text index match through it, while
+// the others match the words as substrings of the prompt or the command,
+// ignoring case.
+func (c *Controller) MatchHistory(query string) []HistoryEntry {
+	history := c.LoadHistory()
+	if res, ok := c.searchIndex(query, history); ok {
+		return res
 	}
-	file, err := os.Open(c.historyPath)
-	if err != nil {
+	words := strings.Fields(strings.ToLower(query))
+	if len(words) == 0 {
 		return nil
 	}
-	defer file.Close()
+	var res []HistoryEntry
+	for _, entry := range history {
+		text := strings.ToLower(entry.Prompt + " " + entry.Command)
+		if !slices.ContainsFunc(words, func(w string) bool { return !strings.Contains(text, w) }) {
+			res = append(res, entry)
+		}
+	}
+	return res
+}
 
-	var entries []HistoryEntry
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		var entry HistoryEntry
-		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
-			continue // Skip malformed entries
+// FindHistory returns the history entry with the given ID.
+func (c *Controller) FindHistory(id string) (HistoryEntry, bool) {
+	for _, entry := range c.LoadHistory() {
+		if entry.ID() == id {
+			return entry, true
 		}
-		entries = append(entries, entry)
 	}
+	return HistoryEntry{}, false
+}
 
-	return entries
+// ImportStats counts the outcome of importing history entries.
+type ImportStats struct {
+	// Added entries were not in history.
+	Added int `json:"added"`
+	// Merged entries were in history, and updated with the imported details.
+	Merged int `json:"merged"`
+	// Unchanged entries were already in history with the same details.
+	Unchanged int `json:"unchanged"`
+	// Ignored entries match the ignore rules of the configuration, or were
+	// imported in incognito mode, and were not saved.
+	Ignored int `json:"ignored"`
 }
 
-func (c *Controller) rewriteHistory(entries []HistoryEntry) error {
-	dir := filepath.Dir(c.historyPath)
-	tmp, err := os.CreateTemp(dir, "tmp-history-*.jsonl")
+// ImportHistory merges the entries into history. Duplicates are merged with
+// the existing entries, so that importing the same entries twice has no
+// effect. The history records are kept as they are, and the imported entries
+// are inserted among them by time, as records of the uses missing from
+// history. Secrets are redacted, and entries are ignored, as in UpdateHistory.
+// The directory ignore rules match the directory the entries were used in.
+func (c *Controller) ImportHistory(entries []HistoryEntry) (ImportStats, error) {
+	if c.incognito {
+		return ImportStats{Ignored: len(entries)}, nil
+	}
+	r, err := c.getRedactor()
 	if err != nil {
-		return err
+		return ImportStats{}, err
+	}
+	store, unlock, err := c.lockHistory()
+	if err != nil {
+		return ImportStats{}, err
+	}
+	defer unlock()
+
+	raw, _, err := c.loadHistory()
+	if err != nil {
+		return ImportStats{}, err
+	}
+	reversed := slices.Clone(raw)
+	slices.Reverse(reversed)
+	index := make(map[historyKey]HistoryEntry)
+	for _, e := range dedupeHistory(reversed) {
+		index[e.key()] = e
 	}
-	defer os.Remove(tmp.Name()) // Clean up temp file
 
-	// Write entries to the temporary file
-	for _, entry := range entries {
-		data, err := json.Marshal(entry)
+	var (
+		stats   ImportStats
+		records []HistoryEntry
+	)
+	for _, e := range entries {
+		ignored, err := c.ignoresHistory(e.Prompt, e.Command, e.Dir)
 		if err != nil {
-			_ = tmp.Close()
-			return fmt.Errorf("marshalling history entry: %w", err)
+			return ImportStats{}, err
+		}
+		if ignored {
+			stats.Ignored++
+			continue
+		}
+		e.Version = historyVersion
+		e.UseCount = max(e.UseCount, 1)
+		e.Prompt, e.Command = r.redactEntry(e.Prompt, e.Command)
+		old, ok := index[e.key()]
+		if !ok {
+			index[e.key()] = e
+			records = append(records, e)
+			stats.Added++
+			continue
 		}
-		if _, err := tmp.WriteString(string(data) + "\n"); err != nil {
-			_ = tmp.Close()
-			return fmt.Errorf("writing to tmp history file: %w", err)
+		merged := old
+		if !merged.absorb(e) {
+			stats.Unchanged++
+			continue
 		}
+		// Only record the uses and runs missing from history.
+		index[e.key()] = merged
+		e.UseCount = merged.UseCount - old.UseCount
+		e.Runs = merged.Runs - old.Runs
+		e.Failures = merged.Failures - old.Failures
+		records = append(records, e)
+		stats.Merged++
 	}
+	if len(records) == 0 {
+		return stats, nil
+	}
+	return stats, store.Replace(insertByTime(raw, records))
+}
 
-	// Flush
-	if err := tmp.Sync(); err != nil {
-		_ = tmp.Close()
-		return fmt.Errorf("syncing tmp history file: %w", err)
+// insertByTime inserts the records into the history, before the first entry
+// that is not older than each of them, leaving the order of the history as
+// it is.
+func insertByTime(history, records []HistoryEntry) []HistoryEntry {
+	slices.SortStableFunc(records, func(a, b HistoryEntry) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+	res := make([]HistoryEntry, 0, len(history)+len(records))
+	for _, e := range history {
+		for len(records) > 0 && !records[0].Timestamp.After(e.Timestamp) {
+			res = append(res, records[0])
+			records = records[1:]
+		}
+		res = append(res, e)
 	}
-	if err := tmp.Close(); err != nil {
-		return err
+	return append(res, records...)
+}
+
+func lastIndexFunc[T any](s []T, f func(T) bool) int {
+	for i := len(s) - 1; i >= 0; i-- {
+		if f(s[i]) {
+			return i
+		}
 	}
+	return -1
+}
 
-	// Rename tmp into the new file (which is atomic)
-	return os.Rename(tmp.Name(), c.historyPath)
+// SetInputSample sets the sample of the input of the commands to generate,
+// as returned by InputSample.
+func (c *Controller) SetInputSample(sample string) {
+	c.inputSample = sample
 }
 
-func (c *Controller) logRejected(entry HistoryEntry) error {
-	f, err := os.OpenFile(c.rejectedPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+// SetIncognito enables or disables the incognito mode, in which the history
+// is not changed by UpdateHistory and ReplaceHistory.
+func (c *Controller) SetIncognito(incognito bool) {
+	c.incognito = incognito
+}
+
+// GenerateCommands returns the preferred commands generated for the prompt.
+func (c *Controller) GenerateCommands(prompt string) ([]string, error) {
+	gen, err := c.Generate(prompt)
 	if err != nil {
-		return fmt.Errorf("opening rejected file: %w", err)
+		return nil, err
+	}
+	return gen.PreferredCommands(), nil
+}
+
+// Generate generates commands for the prompt, returning them together with
+// their validation warnings and details about the generation. Results are
+// cached for the lifetime of the controller.
+//
+// Secrets in the prompt are replaced with placeholders before sending it to
+// the model, and restored in the commands using the same placeholders.
+func (c *Controller) Generate(prompt string) (Generation, error) {
+	return c.GenerateContext(context.Background(), prompt)
+}
+
+// GenerateContext is like Generate, but the request to the model is canceled
+// with the context.
+func (c *Controller) GenerateContext(ctx context.Context, prompt string) (Generation, error) {
+	c.cacheMu.Lock()
+	gen, ok := c.cache[prompt]
+	c.cacheMu.Unlock()
+	if ok {
+		gen.CacheHit = true
+		return gen, nil
+	}
+
+	start := time.Now()
+	model, err := c.getModel(ctx)
+	if err != nil {
+		return Generation{}, err
+	}
+	r, err := c.getRedactor()
+	if err != nil {
+		return Generation{}, err
+	}
+	redaction := r.newRedaction()
+	commands, err := model.GenerateCommands(ctx, PromptInput{
+		UserInput:   redaction.redact(prompt),
+		Shell:       c.shell.DisplayName(),
+		InputSample: c.inputSample,
+	})
+	if err != nil {
+		return Generation{}, err
+	}
+	for i, cmd := range commands {
+		commands[i] = redaction.restore(cmd)
+	}
+	gen = Generation{
+		Prompt:   prompt,
+		Commands: checkCommands(c.shell, commands),
+		Provider: c.cfg.LLM.Provider,
+		Model:    c.cfg.LLM.ModelName,
+		Latency:  time.Since(start),
+		Redacted: redaction.len(),
 	}
-	defer f.Close()
 
-	data, err := json.Marshal(entry)
+	c.cacheMu.Lock()
+	if c.cache == nil {
+		c.cache = make(map[string]Generation)
+	}
+	c.cache[prompt] = gen
+	c.cacheMu.Unlock()
+	return gen, nil
+}
+
+// DescribeCommands asks the model for a short natural language description
+// of each of the commands, which can be used as their prompt in history.
+// Secrets are replaced with placeholders before sending the commands, and
+// restored in the descriptions.
+func (c *Controller) DescribeCommands(commands []string) ([]string, error) {
+	ctx := context.Background()
+	model, err := c.getModel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r, err := c.getRedactor()
 	if err != nil {
-		return fmt.Errorf("marshalling rejected entry: %w", err)
+		return nil, err
+	}
+	redactions := make([]*redaction, len(commands))
+	redacted := make([]string, len(commands))
+	for i, command := range commands {
+		redactions[i] = r.newRedaction()
+		redacted[i] = redactions[i].redact(command)
+	}
+	descriptions, err := model.DescribeCommands(ctx, c.shell.DisplayName(), redacted)
+	if err != nil {
+		return nil, err
+	}
+	for i := range min(len(descriptions), len(redactions)) {
+		descriptions[i] = redactions[i].restore(descriptions[i])
 	}
-	if _, err := f.WriteString(string(data) + "\n"); err != nil {
-		return fmt.Errorf("writing to rejected file: %w", err)
+	return descriptions, nil
+}
+
+// getModel returns the model, creating it on first use. The model is shared
+// by all generations, so that the provider is only initialized once, and it
+// outlives the cancellation of ctx.
+func (c *Controller) getModel(ctx context.Context) (Model, error) {
+	c.modelOnce.Do(func() {
+		c.model, c.modelErr = NewModel(context.WithoutCancel(ctx), c.cfg.LLM)
+		if c.modelErr != nil {
+			c.modelErr = fmt.Errorf("creating model: %w", c.modelErr)
+		}
+	})
+	return c.model, c.modelErr
+}
+
+// getRedactor returns the redactor of the secrets in prompts and history,
+// creating it on first use.
+func (c *Controller) getRedactor() (*redactor, error) {
+	c.redactorOnce.Do(func() {
+		c.redactor, c.redactorErr = newRedactor(c.cfg.Redaction)
+	})
+	return c.redactor, c.redactorErr
+}
+
+// ignoresHistory returns whether the command, generated for the prompt and
+// used in dir, must not be saved in history according to the ignore rules of
+// the configuration.
+func (c *Controller) ignoresHistory(prompt, command, dir string) (bool, error) {
+	c.filterOnce.Do(func() {
+		c.filter, c.filterErr = newHistoryFilter(c.cfg.History.Ignore)
+	})
+	if c.filterErr != nil {
+		return false, c.filterErr
 	}
-	return nil
+	return c.filter.ignores(prompt, command, dir), nil
+}
+
+// getStore returns the history store, opening the configured one on first
+// use.
+func (c *Controller) getStore() (HistoryStore, error) {
+	c.storeOnce.Do(func() {
+		if c.store != nil {
+			return
+		}
+		c.store, c.storeErr = OpenHistoryStore(c.cfg.History)
+		if c.storeErr != nil {
+			c.storeErr = fmt.Errorf("opening history: %w", c.storeErr)
+		}
+	})
+	return c.store, c.storeErr
 }
 
-type HistoryEntry struct {
-	Prompt  string `json:"prompt"`
-	Command string `json:"command"`
+// loadDistinctHistory returns the history without duplicates, most recent
+// first. Stores able to aggregate the duplicates do it themselves.
+func (c *Controller) loadDistinctHistory() []HistoryEntry {
+	if store, err := c.getStore(); err == nil {
+		if a, ok := store.(historyAggregator); ok {
+			if entries, err := a.LoadDistinct(); err == nil {
+				return entries
+			}
+		}
+	}
+	entries, migrated := c.loadHistoryRaw()
+	if migrated {
+		// Best effort, old entries are migrated again at the next load.
+		_ = c.migrateHistory()
+	}
+
+	// Reverse the order to have the most recent entries first.
+	slices.Reverse(entries)
+	return dedupeHistory(entries)
+}
+
+// loadHistoryRaw returns all the history entries, in the order they were
+// added, migrated to the current version. It also returns whether any entry
+// was migrated. Errors are ignored, returning no entries.
+func (c *Controller) loadHistoryRaw() ([]HistoryEntry, bool) {
+	entries, migrated, _ := c.loadHistory()
+	return entries, migrated
+}
+
+// loadHistory is like loadHistoryRaw, but returns the errors reading the
+// history. Changes rewriting the whole history must use it, so that entries
+// that couldn't be read (e.g. because encrypted) are not lost.
+func (c *Controller) loadHistory() ([]HistoryEntry, bool, error) {
+	store, err := c.getStore()
+	if err != nil {
+		return nil, false, err
+	}
+	entries, err := store.Load()
+	if err != nil {
+		return nil, false, fmt.Errorf("reading history: %w", err)
+	}
+	var migrated bool
+	for i := range entries {
+		if entries[i].migrate() {
+			migrated = true
+		}
+	}
+	return entries, migrated, nil
+}
+
+// searchIndex returns the history entries matching the query through the
+// index of the store, in the order of relevance, and whether the store has
+// an index.
+func (c *Controller) searchIndex(query string, history []HistoryEntry) ([]HistoryEntry, bool) {
+	store, err := c.getStore()
+	if err != nil {
+		return nil, false
+	}
+	searcher, ok := store.(historySearcher)
+	if !ok {
+		return nil, false
+	}
+	matches, err := searcher.Search(query)
+	if err != nil {
+		return nil, true
+	}
+	index := make(map[historyKey]int, len(history))
+	for i, e := range history {
+		index[e.key()] = i
+	}
+	var res []HistoryEntry
+	for _, m := range matches {
+		if i, ok := index[m.key()]; ok {
+			res = append(res, history[i])
+		}
+	}
+	return res, true
+}
+
+// lockHistory locks the history store against changes from other processes.
+// All the changes to it must happen with the lock held, so that appends don't
+// get lost when the history is rewritten concurrently.
+func (c *Controller) lockHistory() (HistoryStore, func(), error) {
+	store, err := c.getStore()
+	if err != nil {
+		return nil, nil, err
+	}
+	unlock, err := store.Lock()
+	if err != nil {
+		return nil, nil, fmt.Errorf("locking history: %w", err)
+	}
+	return store, unlock, nil
+}
+
+// migrateHistory rewrites the history with all entries migrated to the
+// current version.
+func (c *Controller) migrateHistory() error {
+	store, unlock, err := c.lockHistory()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	entries, migrated, err := c.loadHistory()
+	if err != nil || !migrated {
+		return err
+	}
+	return store.Replace(entries)
 }
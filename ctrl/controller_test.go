@@ -1,11 +1,17 @@
 package ctrl
 
 import (
+	"fmt"
+	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/mbrt/gencmd/config"
 )
 
 func TestLoadHistory(t *testing.T) {
@@ -21,22 +27,34 @@ func TestLoadHistory(t *testing.T) {
 	}
 
 	// Create a controller and write the entries to the history file
-	controller := &Controller{historyPath: historyPath}
+	controller := &Controller{
+		store: newJSONLStore(historyPath, ""),
+		cfg:   config.Config{History: config.HistoryConfig{Ranking: RankingRecency}},
+	}
 	for _, entry := range entries {
-		err := controller.UpdateHistory(entry.Prompt, entry.Command)
+		err := controller.UpdateHistory(entry.Prompt, entry.Command, SourceGenerated)
 		require.NoError(t, err)
 	}
 
 	// Load the history
-	loadedEntries := controller.LoadHistory()
+	loadedEntries := withoutMetadata(controller.LoadHistory())
 
 	// Check that duplicates are removed and the order is correct
 	expectedEntries := []HistoryEntry{
-		{Prompt: "p3", Command: "c3"},
-		{Prompt: "p1", Command: "c1"},
-		{Prompt: "p2", Command: "c2"},
+		{Prompt: "p3", Command: "c3", UseCount: 1},
+		{Prompt: "p1", Command: "c1", UseCount: 2},
+		{Prompt: "p2", Command: "c2", UseCount: 1},
 	}
 	assert.Equal(t, expectedEntries, loadedEntries)
+
+	// With frecency, the entry used twice comes first.
+	controller.cfg.History.Ranking = RankingFrecency
+	expectedEntries = []HistoryEntry{
+		{Prompt: "p1", Command: "c1", UseCount: 2},
+		{Prompt: "p3", Command: "c3", UseCount: 1},
+		{Prompt: "p2", Command: "c2", UseCount: 1},
+	}
+	assert.Equal(t, expectedEntries, withoutMetadata(controller.LoadHistory()))
 }
 
 func TestDeleteHistory(t *testing.T) {
@@ -47,8 +65,7 @@ func TestDeleteHistory(t *testing.T) {
 
 	// Create a controller
 	controller := &Controller{
-		historyPath:  historyPath,
-		rejectedPath: rejectedPath,
+		store: newJSONLStore(historyPath, rejectedPath),
 	}
 
 	// Add some initial entries
@@ -59,16 +76,16 @@ func TestDeleteHistory(t *testing.T) {
 	}
 
 	for _, entry := range entries {
-		err := controller.UpdateHistory(entry.Prompt, entry.Command)
+		err := controller.UpdateHistory(entry.Prompt, entry.Command, SourceGenerated)
 		require.NoError(t, err)
 	}
 
 	// Load initial history to verify it's there
-	initialHistory := controller.LoadHistory()
+	initialHistory := withoutMetadata(controller.LoadHistory())
 	require.Equal(t, []HistoryEntry{
-		{Prompt: "p3", Command: "c3"},
-		{Prompt: "p2", Command: "c2"},
-		{Prompt: "p1", Command: "c1"},
+		{Prompt: "p3", Command: "c3", UseCount: 1},
+		{Prompt: "p2", Command: "c2", UseCount: 1},
+		{Prompt: "p1", Command: "c1", UseCount: 1},
 	}, initialHistory)
 
 	// Delete the middle entry
@@ -77,16 +94,16 @@ func TestDeleteHistory(t *testing.T) {
 	require.NoError(t, err)
 
 	// Verify the entry was removed from history
-	updatedHistory := controller.LoadHistory()
+	updatedHistory := withoutMetadata(controller.LoadHistory())
 	require.Equal(t, []HistoryEntry{
-		{Prompt: "p3", Command: "c3"},
-		{Prompt: "p1", Command: "c1"},
+		{Prompt: "p3", Command: "c3", UseCount: 1},
+		{Prompt: "p1", Command: "c1", UseCount: 1},
 	}, updatedHistory)
 
 	// Verify the deleted entry was logged to rejected.jsonl
-	rejectedController := &Controller{historyPath: rejectedPath}
-	rejected := rejectedController.LoadHistory()
-	assert.Equal(t, []HistoryEntry{{Prompt: "p2", Command: "c2"}}, rejected)
+	rejectedController := &Controller{store: newJSONLStore(rejectedPath, "")}
+	rejected := withoutMetadata(rejectedController.LoadHistory())
+	assert.Equal(t, []HistoryEntry{{Prompt: "p2", Command: "c2", UseCount: 1}}, rejected)
 }
 
 func TestDeleteHistory_NonExistentEntry(t *testing.T) {
@@ -97,8 +114,7 @@ func TestDeleteHistory_NonExistentEntry(t *testing.T) {
 
 	// Create a controller
 	controller := &Controller{
-		historyPath:  historyPath,
-		rejectedPath: rejectedPath,
+		store: newJSONLStore(historyPath, rejectedPath),
 	}
 
 	// Add some initial entries
@@ -108,7 +124,7 @@ func TestDeleteHistory_NonExistentEntry(t *testing.T) {
 	}
 
 	for _, entry := range entries {
-		err := controller.UpdateHistory(entry.Prompt, entry.Command)
+		err := controller.UpdateHistory(entry.Prompt, entry.Command, SourceGenerated)
 		require.NoError(t, err)
 	}
 
@@ -122,10 +138,10 @@ func TestDeleteHistory_NonExistentEntry(t *testing.T) {
 	require.Len(t, history, 2)
 
 	// Verify the non-existent entry was still logged to rejected.jsonl
-	rejectedController := &Controller{historyPath: rejectedPath}
-	rejectedEntries := rejectedController.LoadHistory()
+	rejectedController := &Controller{store: newJSONLStore(rejectedPath, "")}
+	rejectedEntries := withoutMetadata(rejectedController.LoadHistory())
 	require.Len(t, rejectedEntries, 1)
-	assert.Equal(t, nonExistentEntry, rejectedEntries[0])
+	assert.Equal(t, nonExistentEntry.key(), rejectedEntries[0].key())
 }
 
 func TestDeleteHistory_EmptyHistory(t *testing.T) {
@@ -136,8 +152,7 @@ func TestDeleteHistory_EmptyHistory(t *testing.T) {
 
 	// Create a controller with empty history
 	controller := &Controller{
-		historyPath:  historyPath,
-		rejectedPath: rejectedPath,
+		store: newJSONLStore(historyPath, rejectedPath),
 	}
 
 	// Try to delete from empty history
@@ -150,7 +165,313 @@ func TestDeleteHistory_EmptyHistory(t *testing.T) {
 	assert.Len(t, history, 0)
 
 	// Verify the entry was logged to rejected.jsonl
-	rejectedController := &Controller{historyPath: rejectedPath}
-	rejected := rejectedController.LoadHistory()
-	assert.Equal(t, []HistoryEntry{{Prompt: "p1", Command: "c1"}}, rejected)
+	rejectedController := &Controller{store: newJSONLStore(rejectedPath, "")}
+	rejected := withoutMetadata(rejectedController.LoadHistory())
+	assert.Equal(t, []HistoryEntry{{Prompt: "p1", Command: "c1", UseCount: 1}}, rejected)
+}
+
+func TestConcurrentHistoryUpdates(t *testing.T) {
+	tempDir := t.TempDir()
+	newController := func() *Controller {
+		// Separate controllers, as in separate processes.
+		return &Controller{
+			store: newJSONLStore(filepath.Join(tempDir, "history.jsonl"), filepath.Join(tempDir, "rejected.jsonl")),
+		}
+	}
+	const writers, updates = 4, 20
+	for i := range updates {
+		require.NoError(t, newController().UpdateHistory("del", fmt.Sprintf("d%d", i), SourceGenerated))
+	}
+
+	// Appends interleave with deletes rewriting the history.
+	var wg sync.WaitGroup
+	wg.Add(writers + 1)
+	for w := range writers {
+		go func() {
+			defer wg.Done()
+			c := newController()
+			for i := range updates {
+				assert.NoError(t, c.UpdateHistory("p", fmt.Sprintf("c%d-%d", w, i), SourceGenerated))
+			}
+		}()
+	}
+	go func() {
+		defer wg.Done()
+		c := newController()
+		for i := range updates {
+			assert.NoError(t, c.DeleteHistory(HistoryEntry{Prompt: "del", Command: fmt.Sprintf("d%d", i)}))
+		}
+	}()
+	wg.Wait()
+
+	history := newController().LoadHistory()
+	assert.Len(t, history, writers*updates)
+	for _, e := range history {
+		assert.Equal(t, "p", e.Prompt)
+	}
+}
+
+func TestReplaceHistory(t *testing.T) {
+	tempDir := t.TempDir()
+	controller := &Controller{
+		store: newJSONLStore(filepath.Join(tempDir, "history.jsonl"), filepath.Join(tempDir, "rejected.jsonl")),
+	}
+	for _, entry := range []HistoryEntry{
+		{Prompt: "p1", Command: "c1"},
+		{Prompt: "p2", Command: "c2"},
+		{Prompt: "p1", Command: "c1"},
+	} {
+		require.NoError(t, controller.UpdateHistory(entry.Prompt, entry.Command, SourceGenerated))
+	}
+
+	err := controller.ReplaceHistory(
+		HistoryEntry{Prompt: "p1", Command: "c1"},
+		HistoryEntry{Prompt: "p1", Command: "c1 --edited"},
+	)
+	require.NoError(t, err)
+
+	history := controller.LoadHistory()
+	require.Len(t, history, 2)
+	assert.Equal(t, SourceEdited, history[0].Source)
+	assert.Equal(t, []HistoryEntry{
+		{Prompt: "p1", Command: "c1 --edited", UseCount: 1},
+		{Prompt: "p2", Command: "c2", UseCount: 1},
+	}, withoutMetadata(history))
+	// The original is not rejected.
+	rejected, err := controller.store.Rejected()
+	require.NoError(t, err)
+	assert.Empty(t, rejected)
+}
+
+func TestRecordExecution(t *testing.T) {
+	controller := &Controller{store: newJSONLStore(filepath.Join(t.TempDir(), "history.jsonl"), "")}
+	for _, entry := range []HistoryEntry{
+		{Prompt: "p1", Command: "c1"},
+		{Prompt: "kill", Command: "pkill -u <username>"},
+		{Prompt: "p1", Command: "c1"},
+	} {
+		require.NoError(t, controller.UpdateHistory(entry.Prompt, entry.Command, SourceGenerated))
+	}
+
+	require.NoError(t, controller.RecordExecution("c1", 0, 1500*time.Millisecond))
+	require.NoError(t, controller.RecordExecution("pkill -u alice", 1, 10*time.Millisecond))
+	require.NoError(t, controller.RecordExecution("pkill -u bob", 0, 20*time.Millisecond))
+	assert.ErrorIs(t, controller.RecordExecution("c2", 0, 0), ErrNotInHistory)
+
+	// Only the most recent duplicate is updated.
+	entries, _ := controller.loadHistoryRaw()
+	assert.Equal(t, []HistoryEntry{
+		{Prompt: "p1", Command: "c1", UseCount: 1},
+		{Prompt: "kill", Command: "pkill -u <username>", UseCount: 1, Runs: 2, Failures: 1, LastDurationMs: 20},
+		{Prompt: "p1", Command: "c1", UseCount: 1, Runs: 1, LastDurationMs: 1500},
+	}, withoutMetadata(entries))
+}
+
+func TestLoadHistoryMergesRuns(t *testing.T) {
+	controller := &Controller{store: newJSONLStore(filepath.Join(t.TempDir(), "history.jsonl"), "")}
+	require.NoError(t, controller.store.Replace([]HistoryEntry{
+		{Prompt: "p1", Command: "c1", Runs: 2, Failures: 1, LastExitCode: 2, LastDurationMs: 10},
+		{Prompt: "p2", Command: "c2"},
+		{Prompt: "p1", Command: "c1", Runs: 1, LastDurationMs: 20},
+		{Prompt: "p1", Command: "c1"},
+	}))
+
+	assert.Equal(t, []HistoryEntry{
+		{Prompt: "p1", Command: "c1", UseCount: 3, Runs: 3, Failures: 1, LastDurationMs: 20},
+		{Prompt: "p2", Command: "c2", UseCount: 1},
+	}, withoutMetadata(controller.LoadHistory()))
+}
+
+func TestUpdateHistoryMetadata(t *testing.T) {
+	controller := &Controller{
+		store: newJSONLStore(filepath.Join(t.TempDir(), "history.jsonl"), ""),
+		cfg: config.Config{LLM: config.LLMConfig{
+			Provider:  "googleai",
+			ModelName: "gemini-2.5-flash",
+		}},
+		shell: ShellZsh,
+	}
+	before := time.Now().Add(-time.Second)
+	require.NoError(t, controller.UpdateHistory("p1", "c1", SourceGenerated))
+	require.NoError(t, controller.UpdateHistory("p1", "c1", SourceHistory))
+
+	entries, migrated := controller.loadHistoryRaw()
+	assert.False(t, migrated)
+	require.Len(t, entries, 2)
+	dir, _ := os.Getwd()
+	host, _ := os.Hostname()
+
+	generated := entries[0]
+	assert.Equal(t, historyVersion, generated.Version)
+	assert.Equal(t, SourceGenerated, generated.Source)
+	assert.Equal(t, "googleai", generated.Provider)
+	assert.Equal(t, "gemini-2.5-flash", generated.Model)
+	assert.Equal(t, "zsh", generated.Shell)
+	assert.Equal(t, dir, generated.Dir)
+	assert.Equal(t, host, generated.Host)
+	assert.Equal(t, 1, generated.UseCount)
+	assert.True(t, generated.Timestamp.After(before))
+
+	// The second use comes from history, so it was not generated by a model.
+	reused := entries[1]
+	assert.Equal(t, SourceHistory, reused.Source)
+	assert.Empty(t, reused.Provider)
+	assert.Empty(t, reused.Model)
+
+	history := controller.LoadHistory()
+	require.Len(t, history, 1)
+	assert.Equal(t, 2, history[0].UseCount)
+	assert.Equal(t, SourceHistory, history[0].Source)
+}
+
+func TestLoadHistoryMigratesV1(t *testing.T) {
+	historyPath := filepath.Join(t.TempDir(), "history.jsonl")
+	v1 := `{"prompt":"p1","command":"c1"}
+{"prompt":"p2","command":"c2"}
+{"prompt":"p1","command":"c1"}
+`
+	require.NoError(t, os.WriteFile(historyPath, []byte(v1), 0o600))
+
+	controller := &Controller{store: newJSONLStore(historyPath, "")}
+	assert.Equal(t, []HistoryEntry{
+		{Version: historyVersion, Prompt: "p1", Command: "c1", UseCount: 2},
+		{Version: historyVersion, Prompt: "p2", Command: "c2", UseCount: 1},
+	}, controller.LoadHistory())
+
+	// The file is rewritten in the new format.
+	data, err := os.ReadFile(historyPath)
+	require.NoError(t, err)
+	assert.Equal(t, `{"version":2,"prompt":"p1","command":"c1","useCount":1}
+{"version":2,"prompt":"p2","command":"c2","useCount":1}
+{"version":2,"prompt":"p1","command":"c1","useCount":1}
+`, string(data))
+	_, migrated := controller.loadHistoryRaw()
+	assert.False(t, migrated)
+}
+
+// withoutMetadata returns the entries without the details of the environment
+// they were accepted in, which change between test runs.
+func withoutMetadata(entries []HistoryEntry) []HistoryEntry {
+	var res []HistoryEntry
+	for _, e := range entries {
+		res = append(res, HistoryEntry{
+			Prompt:         e.Prompt,
+			Command:        e.Command,
+			UseCount:       e.UseCount,
+			Runs:           e.Runs,
+			Failures:       e.Failures,
+			LastExitCode:   e.LastExitCode,
+			LastDurationMs: e.LastDurationMs,
+		})
+	}
+	return res
+}
+
+func TestSearchHistory(t *testing.T) {
+	controller := &Controller{
+		store: newJSONLStore(filepath.Join(t.TempDir(), "history.jsonl"), ""),
+		cfg:   config.Config{History: config.HistoryConfig{Ranking: RankingRecency}},
+	}
+	for _, entry := range []HistoryEntry{
+		{Prompt: "list files", Command: "ls -l"},
+		{Prompt: "find jpg files", Command: `find . -name "*.jpg"`},
+		{Prompt: "find go files", Command: `find . -name "*.go"`},
+	} {
+		require.NoError(t, controller.UpdateHistory(entry.Prompt, entry.Command, SourceGenerated))
+	}
+
+	var prompts []string
+	for _, e := range controller.SearchHistory("jpg") {
+		prompts = append(prompts, e.Prompt)
+	}
+	assert.Equal(t, []string{"find jpg files"}, prompts)
+	assert.Len(t, controller.SearchHistory("find"), 2)
+	assert.Empty(t, controller.SearchHistory("zzz"))
+
+	// Without the fuzzy matches.
+	assert.Len(t, controller.SearchHistory("fjpg"), 1)
+	assert.Empty(t, controller.MatchHistory("fjpg"))
+	prompts = nil
+	for _, e := range controller.MatchHistory("FIND jpg") {
+		prompts = append(prompts, e.Prompt)
+	}
+	assert.Equal(t, []string{"find jpg files"}, prompts)
+	assert.Len(t, controller.MatchHistory("find"), 2)
+
+	entry, ok := controller.FindHistory(HistoryEntry{Prompt: "list files", Command: "ls -l"}.ID())
+	assert.True(t, ok)
+	assert.Equal(t, "ls -l", entry.Command)
+	_, ok = controller.FindHistory("00000000")
+	assert.False(t, ok)
+}
+
+func TestImportHistory(t *testing.T) {
+	ts := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	controller := &Controller{
+		store: newJSONLStore(filepath.Join(t.TempDir(), "history.jsonl"), ""),
+		cfg:   config.Config{History: config.HistoryConfig{Ranking: RankingRecency}},
+	}
+	require.NoError(t, controller.store.Replace([]HistoryEntry{
+		{Version: historyVersion, Prompt: "p1", Command: "c1", Timestamp: ts, UseCount: 1},
+		{Version: historyVersion, Prompt: "p2", Command: "c2", Timestamp: ts.Add(time.Hour), UseCount: 1},
+		{Version: historyVersion, Prompt: "p1", Command: "c1", Timestamp: ts.Add(2 * time.Hour), UseCount: 1},
+	}))
+
+	imported := []HistoryEntry{
+		// Already in history, with less details.
+		{Version: historyVersion, Prompt: "p2", Command: "c2", Timestamp: ts, UseCount: 1},
+		// In history, used more and more recently on another machine.
+		{Version: historyVersion, Prompt: "p1", Command: "c1", Timestamp: ts.Add(3 * time.Hour), Host: "other", UseCount: 5},
+		// New.
+		{Version: historyVersion, Prompt: "p3", Command: "c3", Timestamp: ts.Add(-time.Hour), UseCount: 2},
+	}
+	stats, err := controller.ImportHistory(imported)
+	require.NoError(t, err)
+	assert.Equal(t, ImportStats{Added: 1, Merged: 1, Unchanged: 1}, stats)
+
+	want := []HistoryEntry{
+		{Version: historyVersion, Prompt: "p1", Command: "c1", Timestamp: ts.Add(3 * time.Hour), Host: "other", UseCount: 5},
+		{Version: historyVersion, Prompt: "p2", Command: "c2", Timestamp: ts.Add(time.Hour), UseCount: 1},
+		{Version: historyVersion, Prompt: "p3", Command: "c3", Timestamp: ts.Add(-time.Hour), UseCount: 2},
+	}
+	assert.Equal(t, want, controller.LoadHistory())
+	// The existing records are kept, and only the missing uses are added.
+	raw, _ := controller.loadHistoryRaw()
+	assert.Equal(t, []HistoryEntry{
+		{Version: historyVersion, Prompt: "p3", Command: "c3", Timestamp: ts.Add(-time.Hour), UseCount: 2},
+		{Version: historyVersion, Prompt: "p1", Command: "c1", Timestamp: ts, UseCount: 1},
+		{Version: historyVersion, Prompt: "p2", Command: "c2", Timestamp: ts.Add(time.Hour), UseCount: 1},
+		{Version: historyVersion, Prompt: "p1", Command: "c1", Timestamp: ts.Add(2 * time.Hour), UseCount: 1},
+		{Version: historyVersion, Prompt: "p1", Command: "c1", Timestamp: ts.Add(3 * time.Hour), Host: "other", UseCount: 3},
+	}, raw)
+
+	// Importing again is a no-op.
+	stats, err = controller.ImportHistory(imported)
+	require.NoError(t, err)
+	assert.Equal(t, ImportStats{Unchanged: 3}, stats)
+	assert.Equal(t, want, controller.LoadHistory())
+}
+
+func TestHistoryStats(t *testing.T) {
+	ts := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	controller := &Controller{store: newJSONLStore(filepath.Join(t.TempDir(), "history.jsonl"), "")}
+	require.NoError(t, controller.store.Replace([]HistoryEntry{
+		{Version: historyVersion, Prompt: "p1", Command: "c1", Timestamp: ts, Dir: "/src", Source: SourceGenerated, Provider: "openai", Model: "gpt", UseCount: 1},
+		{Version: historyVersion, Prompt: "p2", Command: "c2", Timestamp: ts.Add(time.Hour), Dir: "/tmp", Source: SourceGenerated, Provider: "openai", Model: "gpt", UseCount: 1, Runs: 2, Failures: 1},
+		{Version: historyVersion, Prompt: "p1", Command: "c1", Timestamp: ts.Add(2 * time.Hour), Dir: "/src", Source: SourceHistory, UseCount: 1, Runs: 1},
+	}))
+
+	stats := controller.HistoryStats()
+	assert.Equal(t, 2, stats.Entries)
+	assert.Equal(t, 3, stats.Uses)
+	assert.Equal(t, 3, stats.Runs)
+	assert.Equal(t, 1, stats.Failures)
+	assert.Equal(t, ts, stats.First)
+	assert.Equal(t, ts.Add(2*time.Hour), stats.Last)
+	assert.Equal(t, map[string]int{SourceGenerated: 2, SourceHistory: 1}, stats.Sources)
+	assert.Equal(t, map[string]int{"openai/gpt": 2}, stats.Models)
+	assert.Equal(t, []Count{{"/src", 2}, {"/tmp", 1}}, stats.TopDirs)
+	require.Len(t, stats.TopCommands, 2)
+	assert.Equal(t, "c1", stats.TopCommands[0].Command)
+	assert.Equal(t, 2, stats.TopCommands[0].UseCount)
 }
@@ -0,0 +1,270 @@
+package ctrl
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"golang.org/x/crypto/scrypt"
+
+	"github.com/mbrt/gencmd/config"
+)
+
+// encryptedPrefix starts the encrypted records of the history files. Every
+// record is encrypted on its own, so that entries can still be appended.
+const encryptedPrefix = "age:"
+
+// passphraseWorkFactor is the scrypt work factor deriving the identity from
+// the passphrase. It is lower than the age default, as the identity is
+// derived at every start.
+const passphraseWorkFactor = 15
+
+// saltSize is the size of the random salt deriving the identity from the
+// passphrase.
+const saltSize = 16
+
+// ErrHistoryEncrypted is returned when reading encrypted history without
+// encryption configured.
+var ErrHistoryEncrypted = errors.New("history is encrypted, but no encryption is configured")
+
+// historyCipher encrypts and decrypts the records of the history files with
+// age, for a single X25519 identity.
+type historyCipher struct {
+	identity  *age.X25519Identity
+	recipient *age.X25519Recipient
+	// passphrase and salt derived the identity, when it comes from a
+	// passphrase.
+	passphrase string
+	salt       []byte
+}
+
+// newHistoryCipher returns the cipher configured in cfg, or nil if encryption
+// is not configured.
+//
+// With a passphrase, the identity is derived from it and from the salt stored
+// in saltPath, which is generated randomly on first use.
+func newHistoryCipher(cfg config.EncryptionConfig, saltPath string) (*historyCipher, error) {
+	switch {
+	case cfg.IdentityFile != "" && cfg.PassphraseCommand != "":
+		return nil, fmt.Errorf("only one of identityFile and passphraseCommand can be set")
+	case cfg.IdentityFile != "":
+		id, err := readIdentityFile(cfg.IdentityFile)
+		if err != nil {
+			return nil, err
+		}
+		return &historyCipher{identity: id, recipient: id.Recipient()}, nil
+	case cfg.PassphraseCommand != "":
+		passphrase, err := runSecretCommand(cfg.PassphraseCommand)
+		if err != nil {
+			return nil, err
+		}
+		salt, err := historySalt(saltPath)
+		if err != nil {
+			return nil, err
+		}
+		return newPassphraseCipher(passphrase, salt)
+	default:
+		return nil, nil
+	}
+}
+
+func newPassphraseCipher(passphrase string, salt []byte) (*historyCipher, error) {
+	id, err := passphraseIdentity(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	return &historyCipher{identity: id, recipient: id.Recipient(), passphrase: passphrase, salt: salt}, nil
+}
+
+// withSalt returns the cipher for the files encrypted with the given salt,
+// e.g. by another machine with the same passphrase. Without a passphrase, or
+// without a salt, it's the cipher itself.
+func (c *historyCipher) withSalt(salt []byte) (*historyCipher, error) {
+	if c == nil || c.passphrase == "" || salt == nil || bytes.Equal(salt, c.salt) {
+		return c, nil
+	}
+	return newPassphraseCipher(c.passphrase, salt)
+}
+
+// historySalt returns the salt stored in path, generating it if there is
+// none yet.
+func historySalt(path string) ([]byte, error) {
+	salt, err := readSalt(path)
+	if err != nil || salt != nil {
+		return salt, err
+	}
+	salt = make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if err := writeSalt(path, salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// readSalt returns the salt stored in path, or nil if there is none.
+func readSalt(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading salt: %w", err)
+	}
+	salt, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(salt) == 0 {
+		return nil, fmt.Errorf("invalid salt in %s", path)
+	}
+	return salt, nil
+}
+
+func writeSalt(path string, salt []byte) error {
+	data := base64.StdEncoding.EncodeToString(salt) + "\n"
+	if err := writeFileAtomic(path, []byte(data)); err != nil {
+		return fmt.Errorf("writing salt: %w", err)
+	}
+	return nil
+}
+
+// readIdentityFile returns the first X25519 identity in the age identity file
+// at path.
+func readIdentityFile(path string) (*age.X25519Identity, error) {
+	path, err := config.ExpandHome(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening identity file: %w", err)
+	}
+	defer f.Close()
+	ids, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading identity file %s: %w", path, err)
+	}
+	for _, id := range ids {
+		if id, ok := id.(*age.X25519Identity); ok {
+			return id, nil
+		}
+	}
+	return nil, fmt.Errorf("no X25519 identity in %s", path)
+}
+
+// passphraseIdentity returns the identity derived from the passphrase and the
+// salt with scrypt.
+func passphraseIdentity(passphrase string, salt []byte) (*age.X25519Identity, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<passphraseWorkFactor, 8, 1, 32)
+	if err != nil {
+		return nil, fmt.Errorf("deriving history key: %w", err)
+	}
+	// age only parses identities encoded as strings, with bech32.
+	data, err := bech32.ConvertBits(key, 8, 5, true)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := bech32.Encode("age-secret-key-", data)
+	if err != nil {
+		return nil, err
+	}
+	return age.ParseX25519Identity(strings.ToUpper(encoded))
+}
+
+// encrypt returns the encrypted record of the data, which doesn't contain
+// newlines.
+func (c *historyCipher) encrypt(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, c.recipient)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	res := make([]byte, len(encryptedPrefix)+base64.StdEncoding.EncodedLen(buf.Len()))
+	copy(res, encryptedPrefix)
+	base64.StdEncoding.Encode(res[len(encryptedPrefix):], buf.Bytes())
+	return res, nil
+}
+
+// decrypt returns the data in the encrypted record.
+func (c *historyCipher) decrypt(record []byte) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(string(bytes.TrimPrefix(record, []byte(encryptedPrefix))))
+	if err != nil {
+		return nil, err
+	}
+	r, err := age.Decrypt(bytes.NewReader(data), c.identity)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// isUndecryptable returns whether the error comes from reading records
+// encrypted for another identity, or without encryption configured.
+func isUndecryptable(err error) bool {
+	var noMatch *age.NoIdentityMatchError
+	return errors.Is(err, ErrHistoryEncrypted) || errors.As(err, &noMatch)
+}
+
+// isEncrypted returns whether the line of a history file is an encrypted
+// record.
+func isEncrypted(line []byte) bool {
+	return bytes.HasPrefix(line, []byte(encryptedPrefix))
+}
+
+// EncryptHistory rewrites the history and the rejected entries, encrypting
+// all of them if encrypt is true, or decrypting them otherwise. In both cases
+// encryption must be configured, to read the encrypted entries. It returns the
+// number of entries rewritten.
+func (c *Controller) EncryptHistory(encrypt bool) (int, error) {
+	store, unlock, err := c.lockHistory()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	src, ok := store.(*jsonlStore)
+	if !ok {
+		return 0, fmt.Errorf("encryption is only supported by the %s store", StoreJSONL)
+	}
+	if src.cipher == nil {
+		return 0, fmt.Errorf("no encryption configured, set history.encryption in the configuration")
+	}
+	entries, err := src.Load()
+	if err != nil {
+		return 0, fmt.Errorf("reading history: %w", err)
+	}
+	rejected, err := src.Rejected()
+	if err != nil {
+		return 0, fmt.Errorf("reading rejected entries: %w", err)
+	}
+
+	dst := *src
+	if !encrypt {
+		dst.cipher = nil
+	}
+	if err := dst.Replace(entries); err != nil {
+		return 0, fmt.Errorf("writing history: %w", err)
+	}
+	if len(rejected) > 0 {
+		data, err := encodeJSONL(rejected, dst.cipher)
+		if err != nil {
+			return 0, err
+		}
+		if err := writeFileAtomic(dst.rejectedPath, data); err != nil {
+			return 0, fmt.Errorf("writing rejected entries: %w", err)
+		}
+	}
+	return len(entries) + len(rejected), nil
+}
@@ -0,0 +1,162 @@
+package ctrl
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mbrt/gencmd/config"
+)
+
+func newTestCipher(t *testing.T) (*historyCipher, string) {
+	t.Helper()
+	id, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "identity.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# test identity\n"+id.String()+"\n"), 0o600))
+	cipher, err := newHistoryCipher(config.EncryptionConfig{IdentityFile: path}, "")
+	require.NoError(t, err)
+	return cipher, path
+}
+
+func TestEncryptedStore(t *testing.T) {
+	cipher, _ := newTestCipher(t)
+	dir := t.TempDir()
+	store := newJSONLStore(filepath.Join(dir, "history.jsonl"), filepath.Join(dir, "rejected.jsonl"))
+	store.cipher = cipher
+
+	entries := []HistoryEntry{
+		{Prompt: "list bucket", Command: "gsutil ls gs://secret-bucket"},
+		{Prompt: "p2", Command: "c2"},
+	}
+	for _, e := range entries {
+		require.NoError(t, store.Append(e))
+	}
+	require.NoError(t, store.Reject(HistoryEntry{Prompt: "p3", Command: "c3"}))
+
+	got, err := store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, entries, got)
+	rejected, err := store.Rejected()
+	require.NoError(t, err)
+	assert.Equal(t, []HistoryEntry{{Prompt: "p3", Command: "c3"}}, rejected)
+
+	// Every line is encrypted on its own.
+	data, err := os.ReadFile(store.historyPath)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+	for _, line := range lines {
+		assert.True(t, strings.HasPrefix(line, encryptedPrefix))
+	}
+	assert.NotContains(t, string(data), "secret-bucket")
+
+	// Without the key, the history is not readable.
+	plain := newJSONLStore(store.historyPath, store.rejectedPath)
+	_, err = plain.Load()
+	assert.ErrorIs(t, err, ErrHistoryEncrypted)
+	other, _ := newTestCipher(t)
+	plain.cipher = other
+	_, err = plain.Load()
+	assert.Error(t, err)
+}
+
+func TestEncryptHistory(t *testing.T) {
+	cipher, _ := newTestCipher(t)
+	dir := t.TempDir()
+	store := newJSONLStore(filepath.Join(dir, "history.jsonl"), filepath.Join(dir, "rejected.jsonl"))
+	controller := &Controller{store: store}
+	require.NoError(t, controller.UpdateHistory("p1", "c1", SourceGenerated))
+	require.NoError(t, controller.DeleteHistory(HistoryEntry{Prompt: "p2", Command: "c2"}))
+
+	_, err := controller.EncryptHistory(true)
+	assert.ErrorContains(t, err, "no encryption configured")
+
+	// Plain entries are still read after encryption is configured.
+	store.cipher = cipher
+	require.NoError(t, controller.UpdateHistory("p3", "c3", SourceGenerated))
+	n, err := controller.EncryptHistory(true)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	for _, path := range []string{store.historyPath, store.rejectedPath} {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), "{")
+	}
+	assert.Equal(t, []HistoryEntry{
+		{Prompt: "p3", Command: "c3", UseCount: 1},
+		{Prompt: "p1", Command: "c1", UseCount: 1},
+	}, withoutMetadata(controller.LoadHistory()))
+
+	n, err = controller.EncryptHistory(false)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	store.cipher = nil
+	assert.Len(t, controller.LoadHistory(), 2)
+	rejected, err := store.Rejected()
+	require.NoError(t, err)
+	assert.Len(t, rejected, 1)
+}
+
+func TestPassphraseIdentity(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	id, err := passphraseIdentity("secret", salt)
+	require.NoError(t, err)
+	again, err := passphraseIdentity("secret", salt)
+	require.NoError(t, err)
+	assert.Equal(t, id.String(), again.String())
+	other, err := passphraseIdentity("wrong", salt)
+	require.NoError(t, err)
+	assert.NotEqual(t, id.String(), other.String())
+	other, err = passphraseIdentity("secret", []byte("fedcba9876543210"))
+	require.NoError(t, err)
+	assert.NotEqual(t, id.String(), other.String())
+}
+
+func TestPassphraseCipherSalt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.salt")
+	cfg := config.EncryptionConfig{PassphraseCommand: "echo secret"}
+	cipher, err := newHistoryCipher(cfg, path)
+	require.NoError(t, err)
+	assert.Len(t, cipher.salt, saltSize)
+	record, err := cipher.encrypt([]byte("data"))
+	require.NoError(t, err)
+
+	// The salt is generated once, and kept.
+	again, err := newHistoryCipher(cfg, path)
+	require.NoError(t, err)
+	assert.Equal(t, cipher.salt, again.salt)
+	data, err := again.decrypt(record)
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+
+	// Another history gets another salt, and can only decrypt the record
+	// with the salt it was encrypted with.
+	other, err := newHistoryCipher(cfg, filepath.Join(t.TempDir(), "history.salt"))
+	require.NoError(t, err)
+	assert.NotEqual(t, cipher.salt, other.salt)
+	_, err = other.decrypt(record)
+	assert.True(t, isUndecryptable(err))
+	salted, err := other.withSalt(cipher.salt)
+	require.NoError(t, err)
+	data, err = salted.decrypt(record)
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+}
+
+func TestNewHistoryCipherConflict(t *testing.T) {
+	_, err := newHistoryCipher(config.EncryptionConfig{
+		IdentityFile:      "key.txt",
+		PassphraseCommand: "echo secret",
+	}, "")
+	assert.Error(t, err)
+
+	cipher, err := newHistoryCipher(config.EncryptionConfig{}, "")
+	require.NoError(t, err)
+	assert.Nil(t, cipher)
+}
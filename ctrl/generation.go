@@ -0,0 +1,60 @@
+package ctrl
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Generation is the result of generating commands for a prompt.
+type Generation struct {
+	Prompt   string             `json:"prompt"`
+	Commands []GeneratedCommand `json:"commands"`
+	Provider string             `json:"provider"`
+	Model    string             `json:"model"`
+	Latency  time.Duration      `json:"-"`
+	// Redacted is the number of secrets in the prompt replaced with
+	// placeholders before sending it to the model.
+	Redacted int `json:"redacted,omitempty"`
+	// CacheHit is true when the commands were generated before for the same
+	// prompt by this process, without calling the model again.
+	CacheHit bool `json:"cacheHit"`
+}
+
+// GeneratedCommand is a command generated by the model.
+type GeneratedCommand struct {
+	Command string `json:"command"`
+	// Warnings found validating the command, e.g. syntax errors.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Preferred returns the commands without warnings. If every command has
+// warnings, all of them are returned, as the validation may be wrong.
+func (g Generation) Preferred() []GeneratedCommand {
+	var res []GeneratedCommand
+	for _, c := range g.Commands {
+		if len(c.Warnings) == 0 {
+			res = append(res, c)
+		}
+	}
+	if len(res) == 0 {
+		return g.Commands
+	}
+	return res
+}
+
+// PreferredCommands is like Preferred, but only returns the commands.
+func (g Generation) PreferredCommands() []string {
+	var res []string
+	for _, c := range g.Preferred() {
+		res = append(res, c.Command)
+	}
+	return res
+}
+
+func (g Generation) MarshalJSON() ([]byte, error) {
+	type generation Generation
+	return json.Marshal(struct {
+		generation
+		LatencyMs int64 `json:"latencyMs"`
+	}{generation(g), g.Latency.Milliseconds()})
+}
@@ -0,0 +1,48 @@
+package ctrl
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerationPreferred(t *testing.T) {
+	gen := Generation{Commands: []GeneratedCommand{
+		{Command: `echo "unterminated`, Warnings: []string{"invalid bash syntax"}},
+		{Command: "ls -l"},
+	}}
+	assert.Equal(t, []string{"ls -l"}, gen.PreferredCommands())
+
+	// If nothing is valid, keep everything.
+	gen.Commands = gen.Commands[:1]
+	assert.Equal(t, []string{`echo "unterminated`}, gen.PreferredCommands())
+}
+
+func TestGenerationJSON(t *testing.T) {
+	gen := Generation{
+		Prompt: "list files",
+		Commands: []GeneratedCommand{
+			{Command: "ls -l"},
+			{Command: "ls (", Warnings: []string{"invalid bash syntax"}},
+		},
+		Provider: "googleai",
+		Model:    "gemini-2.5-flash",
+		Latency:  1500 * time.Millisecond,
+	}
+	b, err := json.Marshal(gen)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"prompt": "list files",
+		"commands": [
+			{"command": "ls -l"},
+			{"command": "ls (", "warnings": ["invalid bash syntax"]}
+		],
+		"provider": "googleai",
+		"model": "gemini-2.5-flash",
+		"cacheHit": false,
+		"latencyMs": 1500
+	}`, string(b))
+}
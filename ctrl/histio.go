@@ -0,0 +1,263 @@
+package ctrl
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats to export and import history.
+const (
+	FormatJSONL    = "jsonl"
+	FormatCSV      = "csv"
+	FormatMarkdown = "markdown"
+)
+
+// HistoryFormats lists the supported export and import formats.
+var HistoryFormats = []string{FormatJSONL, FormatCSV, FormatMarkdown}
+
+var csvHeader = []string{
+	"prompt", "command", "timestamp", "dir", "host", "shell", "provider",
+	"model", "source", "useCount", "runs", "failures",
+}
+
+// ExportHistory writes the entries to w in the given format. JSONL keeps all
+// the details of the entries, CSV the most relevant ones, and markdown is a
+// table meant to be read by humans.
+func ExportHistory(w io.Writer, format string, entries []HistoryEntry) error {
+	switch format {
+	case FormatJSONL:
+		enc := json.NewEncoder(w)
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(csvHeader); err != nil {
+			return err
+		}
+		for _, e := range entries {
+			var ts string
+			if !e.Timestamp.IsZero() {
+				ts = e.Timestamp.Format(time.RFC3339)
+			}
+			err := cw.Write([]string{
+				e.Prompt, e.Command, ts, e.Dir, e.Host, e.Shell, e.Provider,
+				e.Model, e.Source, strconv.Itoa(e.UseCount), strconv.Itoa(e.Runs),
+				strconv.Itoa(e.Failures),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+
+	case FormatMarkdown:
+		var b strings.Builder
+		b.WriteString("| Prompt | Command | Last used | Uses |\n")
+		b.WriteString("| --- | --- | --- | --- |\n")
+		for _, e := range entries {
+			var ts string
+			if !e.Timestamp.IsZero() {
+				ts = e.Timestamp.Format(time.RFC3339)
+			}
+			fmt.Fprintf(&b, "| %s | `%s` | %s | %d |\n",
+				escapeMarkdownCell(e.Prompt), escapeMarkdownCell(e.Command), ts, e.UseCount)
+		}
+		_, err := io.WriteString(w, b.String())
+		return err
+
+	default:
+		return fmt.Errorf("unsupported format %q (use one of %s)", format, strings.Join(HistoryFormats, ", "))
+	}
+}
+
+// ParseHistory reads entries written by ExportHistory in the given format.
+// Entries are migrated to the current version, and those without a prompt or
+// a command are skipped.
+func ParseHistory(r io.Reader, format string) ([]HistoryEntry, error) {
+	var (
+		entries []HistoryEntry
+		err     error
+	)
+	switch format {
+	case FormatJSONL:
+		entries, err = parseJSONL(r)
+	case FormatCSV:
+		entries, err = parseCSV(r)
+	case FormatMarkdown:
+		entries, err = parseMarkdown(r)
+	default:
+		return nil, fmt.Errorf("unsupported format %q (use one of %s)", format, strings.Join(HistoryFormats, ", "))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var res []HistoryEntry
+	for _, e := range entries {
+		if e.Prompt == "" || e.Command == "" {
+			continue
+		}
+		e.Version = historyVersion
+		e.UseCount = max(e.UseCount, 1)
+		res = append(res, e)
+	}
+	return res, nil
+}
+
+func parseJSONL(r io.Reader) ([]HistoryEntry, error) {
+	var res []HistoryEntry
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var e HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		res = append(res, e)
+	}
+	return res, scanner.Err()
+}
+
+func parseCSV(r io.Reader) ([]HistoryEntry, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cols := make(map[string]int)
+	for i, name := range header {
+		cols[name] = i
+	}
+	if _, ok := cols["prompt"]; !ok {
+		return nil, errors.New(`missing "prompt" column`)
+	}
+	if _, ok := cols["command"]; !ok {
+		return nil, errors.New(`missing "command" column`)
+	}
+
+	var res []HistoryEntry
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return res, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		field := func(name string) string {
+			if i, ok := cols[name]; ok && i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+		e := HistoryEntry{
+			Prompt:   field("prompt"),
+			Command:  field("command"),
+			Dir:      field("dir"),
+			Host:     field("host"),
+			Shell:    field("shell"),
+			Provider: field("provider"),
+			Model:    field("model"),
+			Source:   field("source"),
+		}
+		if ts := field("timestamp"); ts != "" {
+			if e.Timestamp, err = time.Parse(time.RFC3339, ts); err != nil {
+				return nil, fmt.Errorf("line %d: %w", len(res)+2, err)
+			}
+		}
+		e.UseCount, _ = strconv.Atoi(field("useCount"))
+		e.Runs, _ = strconv.Atoi(field("runs"))
+		e.Failures, _ = strconv.Atoi(field("failures"))
+		res = append(res, e)
+	}
+}
+
+// parseMarkdown parses the table written by ExportHistory. Lines that are not
+// rows of the table are ignored.
+func parseMarkdown(r io.Reader) ([]HistoryEntry, error) {
+	var res []HistoryEntry
+	scanner := bufio.NewScanner(r)
+	header := true
+	for scanner.Scan() {
+		cells := splitMarkdownRow(scanner.Text())
+		if len(cells) < 2 {
+			header = true
+			continue
+		}
+		if header {
+			// Skip the header and the delimiter row.
+			if strings.HasPrefix(cells[0], "---") {
+				header = false
+			}
+			continue
+		}
+		e := HistoryEntry{
+			Prompt:  cells[0],
+			Command: strings.TrimSuffix(strings.TrimPrefix(cells[1], "`"), "`"),
+		}
+		if len(cells) > 2 && cells[2] != "" {
+			e.Timestamp, _ = time.Parse(time.RFC3339, cells[2])
+		}
+		if len(cells) > 3 {
+			e.UseCount, _ = strconv.Atoi(cells[3])
+		}
+		res = append(res, e)
+	}
+	return res, scanner.Err()
+}
+
+// splitMarkdownRow returns the unescaped cells of a markdown table row, or nil
+// if the line is not a row.
+func splitMarkdownRow(line string) []string {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "|") || !strings.HasSuffix(line, "|") || len(line) < 2 {
+		return nil
+	}
+	line = line[1 : len(line)-1]
+
+	var (
+		cells []string
+		cell  strings.Builder
+	)
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && (line[i+1] == '|' || line[i+1] == '\\'):
+			i++
+			cell.WriteByte(line[i])
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == 'n':
+			i++
+			cell.WriteByte('\n')
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// escapeMarkdownCell escapes the text so that it fits in a single cell of a
+// markdown table.
+func escapeMarkdownCell(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "|", `\|`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,108 @@
+package ctrl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImportHistory(t *testing.T) {
+	ts := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	entries := []HistoryEntry{
+		{
+			Version:   historyVersion,
+			Prompt:    "find jpg",
+			Command:   `find . -name "*.jpg"`,
+			Timestamp: ts,
+			UseCount:  3,
+		},
+		{
+			Version:  historyVersion,
+			Prompt:   "pipes | and \\ backslashes",
+			Command:  "printf 'a\\n' | \\\n  grep a",
+			UseCount: 1,
+		},
+	}
+
+	for _, format := range HistoryFormats {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, ExportHistory(&buf, format, entries))
+			got, err := ParseHistory(&buf, format)
+			require.NoError(t, err)
+			assert.Equal(t, entries, got)
+		})
+	}
+}
+
+func TestExportHistoryMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	err := ExportHistory(&buf, FormatMarkdown, []HistoryEntry{
+		{Prompt: "a | b", Command: "a | b", UseCount: 2},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "| Prompt | Command | Last used | Uses |\n"+
+		"| --- | --- | --- | --- |\n"+
+		"| a \\| b | `a \\| b` |  | 2 |\n", buf.String())
+}
+
+func TestParseHistory(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		input   string
+		want    []HistoryEntry
+		wantErr bool
+	}{
+		{
+			name:   "jsonl v1",
+			format: FormatJSONL,
+			input:  "{\"prompt\":\"p1\",\"command\":\"c1\"}\n\n{\"prompt\":\"p2\"}\n",
+			want:   []HistoryEntry{{Version: historyVersion, Prompt: "p1", Command: "c1", UseCount: 1}},
+		},
+		{
+			name:    "jsonl malformed",
+			format:  FormatJSONL,
+			input:   "{\"prompt\":",
+			wantErr: true,
+		},
+		{
+			name:   "csv columns subset",
+			format: FormatCSV,
+			input:  "command,prompt\nc1,p1\n",
+			want:   []HistoryEntry{{Version: historyVersion, Prompt: "p1", Command: "c1", UseCount: 1}},
+		},
+		{
+			name:    "csv missing column",
+			format:  FormatCSV,
+			input:   "prompt\np1\n",
+			wantErr: true,
+		},
+		{
+			name:   "markdown surrounded by text",
+			format: FormatMarkdown,
+			input:  "# Commands\n\n| Prompt | Command |\n|---|---|\n| p1 | `c1` |\n\nThe end.\n",
+			want:   []HistoryEntry{{Version: historyVersion, Prompt: "p1", Command: "c1", UseCount: 1}},
+		},
+		{
+			name:    "unknown format",
+			format:  "xml",
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseHistory(strings.NewReader(tc.input), tc.format)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package ctrl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// historyVersion is the version of the history file format. Entries without
+// a version are from version 1, which only had the prompt and the command.
+const historyVersion = 2
+
+// Sources of history entries.
+const (
+	// SourceGenerated entries were generated by the model.
+	SourceGenerated = "generated"
+	// SourceHistory entries were selected again from history.
+	SourceHistory = "history"
+	// SourceEdited entries were edited before being accepted.
+	SourceEdited = "edited"
+	// SourceShell entries were imported from the history of the shell.
+	SourceShell = "shell"
+)
+
+// HistoryEntry is a command accepted by the user, together with the prompt
+// that produced it.
+//
+// Every use of a command is appended to the history file as a new entry.
+// Duplicates are merged when loading the history.
+type HistoryEntry struct {
+	Version int    `json:"version,omitempty"`
+	Prompt  string `json:"prompt"`
+	Command string `json:"command"`
+	// Timestamp is when the command was last accepted.
+	Timestamp time.Time `json:"timestamp,omitzero"`
+	// Dir is the working directory the command was accepted in.
+	Dir string `json:"dir,omitempty"`
+	// Host is the hostname of the machine the command was accepted on.
+	Host string `json:"host,omitempty"`
+	// Shell is the shell the command was generated for.
+	Shell string `json:"shell,omitempty"`
+	// Provider and Model that generated the command, if it was generated.
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+	// Source tells how the command was obtained (e.g. SourceGenerated).
+	Source string `json:"source,omitempty"`
+	// UseCount is the number of times the command was accepted.
+	UseCount int `json:"useCount,omitempty"`
+	// Runs is the number of times the command was executed, as reported by
+	// the shell hooks.
+	Runs int `json:"runs,omitempty"`
+	// Failures is the number of runs with a non-zero exit code.
+	Failures int `json:"failures,omitempty"`
+	// LastExitCode is the exit code of the most recent run.
+	LastExitCode int `json:"lastExitCode,omitempty"`
+	// LastDurationMs is the duration of the most recent run, in milliseconds.
+	LastDurationMs int64 `json:"lastDurationMs,omitempty"`
+	// RejectedAt is when the entry was deleted, and is only set in rejected
+	// entries.
+	RejectedAt time.Time `json:"rejectedAt,omitzero"`
+}
+
+// historyKey identifies the duplicates of a history entry.
+type historyKey struct {
+	prompt, command string
+}
+
+func (e HistoryEntry) key() historyKey {
+	return historyKey{e.Prompt, e.Command}
+}
+
+// ID returns a short identifier of the entry, which is the same for all of its
+// duplicates.
+func (e HistoryEntry) ID() string {
+	sum := sha256.Sum256([]byte(e.Prompt + "\x00" + e.Command))
+	return hex.EncodeToString(sum[:4])
+}
+
+// merge adds the uses and runs of an older duplicate of the entry.
+func (e *HistoryEntry) merge(older HistoryEntry) {
+	if e.Runs == 0 {
+		e.LastExitCode = older.LastExitCode
+		e.LastDurationMs = older.LastDurationMs
+	}
+	e.UseCount += older.UseCount
+	e.Runs += older.Runs
+	e.Failures += older.Failures
+}
+
+// absorb merges an entry with the same key coming from another history (e.g.
+// an export), returning whether the entry changed. Unlike merge, absorbing the
+// same entry twice has no effect, as the counters take the maximum.
+func (e *HistoryEntry) absorb(other HistoryEntry) bool {
+	before := *e
+	if other.Timestamp.After(e.Timestamp) {
+		useCount, runs, failures := e.UseCount, e.Runs, e.Failures
+		*e = other
+		e.UseCount, e.Runs, e.Failures = useCount, runs, failures
+	}
+	e.UseCount = max(e.UseCount, other.UseCount)
+	e.Runs = max(e.Runs, other.Runs)
+	e.Failures = max(e.Failures, other.Failures)
+	return *e != before
+}
+
+// dedupeHistory removes the duplicates of the entries, given from the most
+// recent, keeping the most recent and merging the uses and runs of all of
+// them.
+func dedupeHistory(entries []HistoryEntry) []HistoryEntry {
+	seen := make(map[historyKey]int)
+	var result []HistoryEntry
+	for _, entry := range entries {
+		i, ok := seen[entry.key()]
+		if !ok {
+			seen[entry.key()] = len(result)
+			result = append(result, entry)
+			continue
+		}
+		result[i].merge(entry)
+	}
+	return result
+}
+
+// migrate upgrades the entry to the current version. It returns false if the
+// entry was already up to date.
+func (e *HistoryEntry) migrate() bool {
+	if e.Version >= historyVersion {
+		return false
+	}
+	// Every version 1 entry is a single use.
+	e.Version = historyVersion
+	e.UseCount = 1
+	return true
+}
@@ -0,0 +1,76 @@
+package ctrl
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/mbrt/gencmd/config"
+)
+
+// historyFilter tells which commands are not saved in history, according to
+// the ignore rules in the configuration.
+type historyFilter struct {
+	prompts  []*regexp.Regexp
+	commands []*regexp.Regexp
+	dirs     []string
+}
+
+func newHistoryFilter(cfg config.IgnoreConfig) (*historyFilter, error) {
+	var (
+		f   historyFilter
+		err error
+	)
+	if f.prompts, err = compilePatterns(cfg.Prompts); err != nil {
+		return nil, fmt.Errorf("invalid history.ignore.prompts: %w", err)
+	}
+	if f.commands, err = compilePatterns(cfg.Commands); err != nil {
+		return nil, fmt.Errorf("invalid history.ignore.commands: %w", err)
+	}
+	for _, dir := range cfg.Dirs {
+		dir, err := config.ExpandHome(dir)
+		if err != nil {
+			return nil, err
+		}
+		f.dirs = append(f.dirs, filepath.Clean(dir))
+	}
+	return &f, nil
+}
+
+// ignores returns whether the command, generated for the prompt and used in
+// dir, must not be saved.
+func (f *historyFilter) ignores(prompt, command, dir string) bool {
+	for _, re := range f.prompts {
+		if re.MatchString(prompt) {
+			return true
+		}
+	}
+	for _, re := range f.commands {
+		if re.MatchString(command) {
+			return true
+		}
+	}
+	if dir == "" {
+		return false
+	}
+	for _, d := range f.dirs {
+		rel, err := filepath.Rel(d, dir)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
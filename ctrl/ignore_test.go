@@ -0,0 +1,100 @@
+package ctrl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mbrt/gencmd/config"
+)
+
+func TestHistoryFilter(t *testing.T) {
+	f, err := newHistoryFilter(config.IgnoreConfig{
+		Prompts:  []string{`(?i)\bprivate\b`},
+		Commands: []string{`^(rm|shred) `},
+		Dirs:     []string{"/home/me/secret/"},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		prompt, command, dir string
+		want                 bool
+	}{
+		{"list files", "ls -l", "/home/me", false},
+		{"list Private files", "ls -l", "/home/me", true},
+		{"delete the file", "rm -f x", "/home/me", true},
+		{"delete the file", "git rm x", "/home/me", false},
+		{"list files", "ls -l", "/home/me/secret", true},
+		{"list files", "ls -l", "/home/me/secret/sub", true},
+		{"list files", "ls -l", "/home/me/secrets", false},
+		{"list files", "ls -l", "", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, f.ignores(tt.prompt, tt.command, tt.dir), "%+v", tt)
+	}
+
+	_, err = newHistoryFilter(config.IgnoreConfig{Commands: []string{`(`}})
+	assert.ErrorContains(t, err, "history.ignore.commands")
+}
+
+func TestIgnoredHistory(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	cfg := config.Config{History: config.HistoryConfig{Ignore: config.IgnoreConfig{
+		Prompts:  []string{`^forget`},
+		Commands: []string{`^shred `},
+		Dirs:     []string{wd},
+	}}}
+	newController := func(cfg config.Config) *Controller {
+		return &Controller{cfg: cfg, store: newJSONLStore(
+			filepath.Join(dir, "history.jsonl"),
+			filepath.Join(dir, "rejected.jsonl"),
+		)}
+	}
+
+	controller := newController(config.Config{})
+	require.NoError(t, controller.UpdateHistory("p1", "c1", SourceGenerated))
+	controller.SetIncognito(true)
+	require.NoError(t, controller.UpdateHistory("p2", "c2", SourceGenerated))
+	require.NoError(t, controller.ReplaceHistory(
+		HistoryEntry{Prompt: "p1", Command: "c1"},
+		HistoryEntry{Prompt: "p3", Command: "c3"}))
+	assert.Equal(t, []HistoryEntry{{Prompt: "p1", Command: "c1", UseCount: 1}},
+		withoutMetadata(controller.LoadHistory()))
+
+	// Everything is ignored in the working directory.
+	controller = newController(cfg)
+	require.NoError(t, controller.UpdateHistory("p4", "c4", SourceGenerated))
+	cfg.History.Ignore.Dirs = nil
+	controller = newController(cfg)
+	require.NoError(t, controller.UpdateHistory("forget this", "c5", SourceGenerated))
+	require.NoError(t, controller.UpdateHistory("p6", "shred -u key.pem", SourceGenerated))
+	// Edits matching the rules only remove the old entry.
+	require.NoError(t, controller.ReplaceHistory(
+		HistoryEntry{Prompt: "p1", Command: "c1"},
+		HistoryEntry{Prompt: "forget p1", Command: "c1"}))
+	assert.Empty(t, controller.LoadHistory())
+
+	// Imports follow the same rules, with the directories of the entries.
+	cfg.History.Ignore.Dirs = []string{"/secret"}
+	controller = newController(cfg)
+	stats, err := controller.ImportHistory([]HistoryEntry{
+		{Prompt: "forget this", Command: "c7"},
+		{Prompt: "p8", Command: "shred -u key.pem"},
+		{Prompt: "p9", Command: "c9", Dir: "/secret/project"},
+		{Prompt: "p10", Command: "c10", Dir: "/tmp"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ImportStats{Added: 1, Ignored: 3}, stats)
+	assert.Equal(t, []HistoryEntry{{Prompt: "p10", Command: "c10", UseCount: 1}},
+		withoutMetadata(controller.LoadHistory()))
+	controller.SetIncognito(true)
+	stats, err = controller.ImportHistory([]HistoryEntry{{Prompt: "p11", Command: "c11"}})
+	require.NoError(t, err)
+	assert.Equal(t, ImportStats{Ignored: 1}, stats)
+	assert.Len(t, controller.LoadHistory(), 1)
+}
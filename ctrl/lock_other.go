@@ -0,0 +1,9 @@
+//go:build !unix
+
+package ctrl
+
+// lockFile is a no-op on platforms without flock, where concurrent changes to
+// the history are not protected.
+func lockFile(string) (func(), error) {
+	return func() {}, nil
+}
@@ -3,6 +3,7 @@ package ctrl
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
@@ -52,9 +53,20 @@ type Model struct {
 	promptTemplate string
 }
 
+// PromptInput holds the values available to the prompt template.
+type PromptInput struct {
+	// UserInput is the natural language description of the command.
+	UserInput string
+	// Shell is the name of the shell to generate commands for.
+	Shell string
+	// InputSample is a fenced sample of the data piped into the command, if
+	// any. See InputSample.
+	InputSample string
+}
+
 // GenerateCommands generates commands based on the provided prompt.
-func (m Model) GenerateCommands(ctx context.Context, prompt string) ([]string, error) {
-	text, err := templatePrompt(m.promptTemplate, prompt)
+func (m Model) GenerateCommands(ctx context.Context, input PromptInput) ([]string, error) {
+	text, err := templatePrompt(m.promptTemplate, input)
 	if err != nil {
 		return nil, fmt.Errorf("templating prompt: %w", err)
 	}
@@ -75,9 +87,46 @@ func (m Model) GenerateCommands(ctx context.Context, prompt string) ([]string, e
 	return *item, nil
 }
 
+const describePrompt = `You are a command line expert. Describe each of the following %s commands in a few words, as a user would ask for it (e.g. "find all jpg files in subdirectories"). Do not mention the name of the shell. Return exactly one description per command, in the same order.
+
+The commands are given as a JSON array:
+%s
+`
+
+// DescribeCommands returns a short natural language description of each of
+// the commands, in the same order.
+func (m Model) DescribeCommands(ctx context.Context, shell string, commands []string) ([]string, error) {
+	data, err := json.Marshal(commands)
+	if err != nil {
+		return nil, err
+	}
+	opts := []ai.GenerateOption{
+		ai.WithPrompt(fmt.Sprintf(describePrompt, shell, data)),
+	}
+	if m.model != nil {
+		opts = append(opts, ai.WithModel(m.model))
+	}
+
+	item, resp, err := genkit.GenerateData[[]string](ctx, m.client, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("describing commands: %w", err)
+	}
+	if resp == nil || item == nil {
+		return nil, fmt.Errorf("no response from model")
+	}
+	if len(*item) != len(commands) {
+		return nil, fmt.Errorf("got %d descriptions for %d commands", len(*item), len(commands))
+	}
+	return *item, nil
+}
+
 func newGeminiModel(ctx context.Context, cfg config.LLMConfig) (Model, error) {
+	key, err := apiKey(cfg, "GEMINI_API_KEY")
+	if err != nil {
+		return Model{}, err
+	}
 	g := genkit.Init(ctx,
-		genkit.WithPlugins(&googlegenai.GoogleAI{}),
+		genkit.WithPlugins(&googlegenai.GoogleAI{APIKey: key}),
 		genkit.WithDefaultModel("googleai/"+cfg.ModelName),
 	)
 	return Model{
@@ -105,13 +154,17 @@ func newVertexAIModel(ctx context.Context, cfg config.LLMConfig) (Model, error)
 }
 
 func newOpenAIModel(ctx context.Context, cfg config.LLMConfig) (Model, error) {
+	key, err := apiKey(cfg, "OPENAI_API_KEY")
+	if err != nil {
+		return Model{}, err
+	}
 	var opts []option.RequestOption
 	if cfg.OpenAI != nil && cfg.OpenAI.BaseURL != "" {
 		opts = append(opts, option.WithBaseURL(cfg.OpenAI.BaseURL))
 	}
 
 	g := genkit.Init(ctx,
-		genkit.WithPlugins(&openai.OpenAI{Opts: opts}),
+		genkit.WithPlugins(&openai.OpenAI{APIKey: key, Opts: opts}),
 		genkit.WithDefaultModel("openai/"+cfg.ModelName),
 	)
 	return Model{
@@ -121,10 +174,14 @@ func newOpenAIModel(ctx context.Context, cfg config.LLMConfig) (Model, error) {
 }
 
 func newAnthropicModel(ctx context.Context, cfg config.LLMConfig) (Model, error) {
+	key, err := apiKey(cfg, "ANTHROPIC_API_KEY")
+	if err != nil {
+		return Model{}, err
+	}
 	g := genkit.Init(ctx,
 		genkit.WithPlugins(&anthropic.Anthropic{
 			Opts: []option.RequestOption{
-				option.WithAPIKey(os.Getenv("ANTHROPIC_API_KEY")),
+				option.WithAPIKey(key),
 			},
 		}),
 		genkit.WithDefaultModel("anthropic/"+cfg.ModelName),
@@ -168,18 +225,14 @@ func newOllamaModel(ctx context.Context, cfg config.LLMConfig) (Model, error) {
 	}, nil
 }
 
-func templatePrompt(templateStr, prompt string) (string, error) {
+func templatePrompt(templateStr string, input PromptInput) (string, error) {
 	tmpl, err := template.New("prompt").Parse(templateStr)
 	if err != nil {
 		return "", fmt.Errorf("parsing template: %w", err)
 	}
 
-	data := struct{ UserInput string }{
-		UserInput: prompt,
-	}
-
 	var buf bytes.Buffer
-	err = tmpl.Execute(&buf, data)
+	err = tmpl.Execute(&buf, input)
 	if err != nil {
 		return "", fmt.Errorf("executing template: %w", err)
 	}
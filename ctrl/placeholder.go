@@ -0,0 +1,76 @@
+package ctrl
+
+import (
+	"regexp"
+	"strings"
+)
+
+// placeholderRe matches placeholders like <username>, <file.json>,
+// <remote branch> or YOUR_BUCKET. Redirections and here-strings (e.g.
+// `sort <in.txt >out.txt` or `<<<`) don't match.
+var placeholderRe = regexp.MustCompile(`<[A-Za-z][\w.\-]*(?: [\w.\-]+)*>|\bYOUR_[A-Z0-9_]*[A-Z0-9]\b`)
+
+// Placeholder is a part of a command meant to be replaced by the user.
+type Placeholder struct {
+	// Text is the placeholder as it appears in the command (e.g. <file.json>).
+	Text string
+	// Name is the placeholder without delimiters (e.g. file.json).
+	Name string
+}
+
+// FindPlaceholders returns the distinct placeholders in the command, in order
+// of appearance.
+func FindPlaceholders(command string) []Placeholder {
+	var res []Placeholder
+	seen := make(map[string]bool)
+	for _, text := range placeholderRe.FindAllString(command, -1) {
+		if seen[text] {
+			continue
+		}
+		seen[text] = true
+		name := strings.TrimSuffix(strings.TrimPrefix(text, "<"), ">")
+		res = append(res, Placeholder{Text: text, Name: name})
+	}
+	return res
+}
+
+// FillPlaceholders replaces the placeholders in the command with the given
+// values. Placeholders without a value are left untouched.
+func FillPlaceholders(command string, values map[string]string) string {
+	return placeholderRe.ReplaceAllStringFunc(command, func(text string) string {
+		if v := values[text]; v != "" {
+			return v
+		}
+		return text
+	})
+}
+
+// withoutPlaceholders returns the command with its placeholders replaced by
+// a plain word, so that its syntax can be checked.
+func withoutPlaceholders(command string) string {
+	return placeholderRe.ReplaceAllString(command, "placeholder")
+}
+
+// matchesTemplate returns whether the command is the template with its
+// placeholders filled in, or the template itself.
+func matchesTemplate(template, command string) bool {
+	if template == command {
+		return true
+	}
+	locs := placeholderRe.FindAllStringIndex(template, -1)
+	if len(locs) == 0 {
+		return false
+	}
+	var b strings.Builder
+	b.WriteString("^")
+	prev := 0
+	for _, loc := range locs {
+		b.WriteString(regexp.QuoteMeta(template[prev:loc[0]]))
+		b.WriteString("(?s:.+?)")
+		prev = loc[1]
+	}
+	b.WriteString(regexp.QuoteMeta(template[prev:]))
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	return err == nil && re.MatchString(command)
+}
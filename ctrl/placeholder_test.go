@@ -0,0 +1,75 @@
+package ctrl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindPlaceholders(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []Placeholder
+	}{
+		{
+			command: "pkill -u <username>",
+			want:    []Placeholder{{Text: "<username>", Name: "username"}},
+		},
+		{
+			command: "jq . <file.json> | gsutil cp - gs://YOUR_BUCKET/<file.json>",
+			want: []Placeholder{
+				{Text: "<file.json>", Name: "file.json"},
+				{Text: "YOUR_BUCKET", Name: "YOUR_BUCKET"},
+			},
+		},
+		{
+			command: "git push origin <remote branch>",
+			want:    []Placeholder{{Text: "<remote branch>", Name: "remote branch"}},
+		},
+		{
+			command: `sort <in.txt >out.txt`,
+		},
+		{
+			command: `head -1 <<< "$(jq -c '.[-1]' file.json)"`,
+		},
+		{
+			command: "echo $YOUR_ && ls",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			assert.Equal(t, tt.want, FindPlaceholders(tt.command))
+		})
+	}
+}
+
+func TestFillPlaceholders(t *testing.T) {
+	got := FillPlaceholders("cp <src file> <dest> && echo <src file> YOUR_NAME", map[string]string{
+		"<src file>": "a.txt",
+		"<dest>":     "",
+		"YOUR_NAME":  "bob",
+	})
+	assert.Equal(t, "cp a.txt <dest> && echo a.txt bob", got)
+}
+
+func TestMatchesTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		command  string
+		want     bool
+	}{
+		{template: "ls -l", command: "ls -l", want: true},
+		{template: "ls -l", command: "ls -la", want: false},
+		{template: "pkill -u <username>", command: "pkill -u alice", want: true},
+		{template: "pkill -u <username>", command: "pkill -u <username>", want: true},
+		{template: "pkill -u <username>", command: "pkill -9 -u alice", want: false},
+		{template: "cp <src> <dst> # (copy)", command: "cp a b # (copy)", want: true},
+		{template: "gsutil ls gs://YOUR_BUCKET", command: "gsutil ls gs://logs", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			assert.Equal(t, tt.want, matchesTemplate(tt.template, tt.command))
+		})
+	}
+}
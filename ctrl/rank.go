@@ -0,0 +1,59 @@
+package ctrl
+
+import (
+	"slices"
+	"time"
+)
+
+// Ranking orders of the history.
+const (
+	RankingFrecency = "frecency"
+	RankingRecency  = "recency"
+)
+
+const defaultDirectoryBoost = 2
+
+// frecency returns the score of the entry, based on how often and how
+// recently it was used. Like in zoxide, the use count is weighted by how long
+// ago the entry was last used. Entries last used in dir have their score
+// multiplied by dirBoost.
+func frecency(e HistoryEntry, now time.Time, dir string, dirBoost float64) float64 {
+	score := float64(max(e.UseCount, 1))
+	switch age := now.Sub(e.Timestamp); {
+	case e.Timestamp.IsZero():
+		// Entries from before timestamps were recorded are considered old.
+		score /= 4
+	case age < time.Hour:
+		score *= 4
+	case age < 24*time.Hour:
+		score *= 2
+	case age < 7*24*time.Hour:
+		score /= 2
+	default:
+		score /= 4
+	}
+	if dir != "" && e.Dir == dir {
+		score *= dirBoost
+	}
+	return score
+}
+
+// rankFrecency sorts the entries by decreasing frecency. Entries with the
+// same score keep their relative order.
+func rankFrecency(entries []HistoryEntry, now time.Time, dir string, dirBoost float64) {
+	scores := make(map[historyKey]float64, len(entries))
+	for _, e := range entries {
+		scores[e.key()] = frecency(e, now, dir, dirBoost)
+	}
+	slices.SortStableFunc(entries, func(a, b HistoryEntry) int {
+		sa, sb := scores[a.key()], scores[b.key()]
+		switch {
+		case sa > sb:
+			return -1
+		case sa < sb:
+			return 1
+		default:
+			return 0
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package ctrl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrecency(t *testing.T) {
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		entry HistoryEntry
+		want  float64
+	}{
+		{
+			name:  "last hour",
+			entry: HistoryEntry{UseCount: 3, Timestamp: now.Add(-time.Minute)},
+			want:  12,
+		},
+		{
+			name:  "last day",
+			entry: HistoryEntry{UseCount: 3, Timestamp: now.Add(-2 * time.Hour)},
+			want:  6,
+		},
+		{
+			name:  "last week",
+			entry: HistoryEntry{UseCount: 3, Timestamp: now.Add(-3 * 24 * time.Hour)},
+			want:  1.5,
+		},
+		{
+			name:  "older",
+			entry: HistoryEntry{UseCount: 3, Timestamp: now.Add(-30 * 24 * time.Hour)},
+			want:  0.75,
+		},
+		{
+			name:  "no timestamp",
+			entry: HistoryEntry{},
+			want:  0.25,
+		},
+		{
+			name:  "same directory",
+			entry: HistoryEntry{UseCount: 1, Timestamp: now, Dir: "/src"},
+			want:  12,
+		},
+		{
+			name:  "other directory",
+			entry: HistoryEntry{UseCount: 1, Timestamp: now, Dir: "/tmp"},
+			want:  4,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, frecency(tc.entry, now, "/src", 3))
+		})
+	}
+}
+
+func TestRankFrecency(t *testing.T) {
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	entries := []HistoryEntry{
+		{Prompt: "today", UseCount: 1, Timestamp: now.Add(-5 * time.Hour)},
+		{Prompt: "yesterday", UseCount: 1, Timestamp: now.Add(-25 * time.Hour)},
+		{Prompt: "last month", UseCount: 50, Timestamp: now.Add(-30 * 24 * time.Hour)},
+		{Prompt: "here", UseCount: 1, Timestamp: now.Add(-26 * time.Hour), Dir: "/src"},
+		{Prompt: "old", UseCount: 1},
+	}
+	rankFrecency(entries, now, "/src", 2)
+
+	var prompts []string
+	for _, e := range entries {
+		prompts = append(prompts, e.Prompt)
+	}
+	assert.Equal(t, []string{"last month", "today", "here", "yesterday", "old"}, prompts)
+}
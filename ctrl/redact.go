@@ -0,0 +1,228 @@
+package ctrl
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/mbrt/gencmd/config"
+)
+
+// minSecretLen is the length of the shortest value redacted as a secret.
+// Every occurrence of a secret is redacted, which would mangle the text for
+// shorter values.
+const minSecretLen = 4
+
+// Thresholds of the high-entropy strings (e.g. random tokens) redacted from
+// prompts and history.
+const (
+	minEntropyLen = 20
+	minEntropy    = 3.5 // bits per character
+)
+
+// secretPattern matches a kind of secret. The secret is in the group named
+// "secret" if there is one, or is the whole match otherwise.
+type secretPattern struct {
+	re *regexp.Regexp
+	// repl replaces the whole match in input samples.
+	repl string
+	// name is the placeholder replacing the secret in prompts and history.
+	name string
+}
+
+var (
+	// secretPatterns match the secrets most commonly found in command
+	// output and prompts.
+	secretPatterns = []secretPattern{
+		{regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----(?s:.*?)(?:-----END [A-Z ]*PRIVATE KEY-----|\z)`), "<redacted private key>", "private key"},
+		{regexp.MustCompile(`(?i)\b(bearer|basic)\s+(?P<secret>[A-Za-z0-9._~+/=-]{8,})`), "$1 <redacted>", "token"},
+		{regexp.MustCompile(`(?i)\b([A-Za-z0-9_-]*(?:password|passwd|secret|token|api[_-]?key|access[_-]?key|credentials?))(["']?\s*[:=]\s*["']?)(?P<secret>[^\s"',;]+)`), "$1$2<redacted>", "secret"},
+		{regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`), "<redacted>", "aws key"},
+		{regexp.MustCompile(`\b(?:sk-(?:proj-)?[A-Za-z0-9_-]{20,}|gh[pousr]_[A-Za-z0-9]{36,}|github_pat_\w{22,}|glpat-[A-Za-z0-9_-]{20,}|xox[abprs]-[A-Za-z0-9-]{10,}|AIza[0-9A-Za-z_-]{35})`), "<redacted>", "api key"},
+		{regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`), "<redacted>", "jwt"},
+		{regexp.MustCompile(`://(?P<secret>[^/\s:@]+:[^/\s@]+)@`), "://<redacted>@", "credentials"},
+	}
+
+	// entropyCandidateRe matches the strings checked for high entropy.
+	entropyCandidateRe = regexp.MustCompile(`[A-Za-z0-9+=_-]{20,}`)
+)
+
+// redactSecrets replaces the common secrets in the input sample.
+func redactSecrets(text string) string {
+	for _, p := range secretPatterns {
+		text = p.re.ReplaceAllString(text, p.repl)
+	}
+	return text
+}
+
+// redactor finds the secrets in prompts and commands, with the built-in
+// patterns, the custom ones in the configuration and an entropy check.
+type redactor struct {
+	disabled bool
+	patterns []secretPattern
+}
+
+func newRedactor(cfg config.RedactionConfig) (*redactor, error) {
+	r := &redactor{disabled: cfg.Disabled}
+	for _, p := range cfg.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", p, err)
+		}
+		r.patterns = append(r.patterns, secretPattern{re: re, name: "secret"})
+	}
+	r.patterns = append(r.patterns, secretPatterns...)
+	return r, nil
+}
+
+// redactEntry returns the prompt and the command of a history entry with
+// their secrets replaced by placeholders. Secrets found in either of them are
+// redacted from both.
+func (r *redactor) redactEntry(prompt, command string) (string, string) {
+	d := r.newRedaction()
+	prompt = d.redact(prompt)
+	command = d.redact(command)
+	return d.redact(prompt), command
+}
+
+// redaction replaces the secrets in related texts (e.g. a prompt and the
+// commands generated for it) with placeholders, and restores them.
+type redaction struct {
+	r *redactor
+	// secrets by placeholder, and placeholders by secret.
+	secrets      map[string]string
+	placeholders map[string]string
+	names        map[string]int
+}
+
+func (r *redactor) newRedaction() *redaction {
+	return &redaction{
+		r:            r,
+		secrets:      make(map[string]string),
+		placeholders: make(map[string]string),
+		names:        make(map[string]int),
+	}
+}
+
+// redact returns the text with the secrets replaced by placeholders like
+// <token>. The secrets found in the texts redacted before are replaced too,
+// so that the same secret has the same placeholder everywhere.
+func (d *redaction) redact(text string) string {
+	if d.r.disabled {
+		return text
+	}
+	// Replace the secrets found by each pattern before trying the next, so
+	// that parts of a secret are not matched again.
+	text = d.replace(text)
+	for _, p := range d.r.patterns {
+		group := max(p.re.SubexpIndex("secret"), 0)
+		for _, m := range p.re.FindAllStringSubmatchIndex(text, -1) {
+			if m[2*group] >= 0 {
+				d.add(text[m[2*group]:m[2*group+1]], p.name)
+			}
+		}
+		text = d.replace(text)
+	}
+	for _, s := range entropyCandidateRe.FindAllString(text, -1) {
+		if isHighEntropy(s) {
+			d.add(s, "secret")
+		}
+	}
+	return d.replace(text)
+}
+
+// restore returns the text with the placeholders replaced by the secrets.
+func (d *redaction) restore(text string) string {
+	if len(d.secrets) == 0 {
+		return text
+	}
+	var pairs []string
+	for placeholder, secret := range d.secrets {
+		pairs = append(pairs, placeholder, secret)
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// hasSecrets returns whether the text contains secrets to redact.
+func (r *redactor) hasSecrets(text string) bool {
+	d := r.newRedaction()
+	d.redact(text)
+	return d.len() > 0
+}
+
+// len returns the number of distinct secrets redacted.
+func (d *redaction) len() int {
+	return len(d.secrets)
+}
+
+func (d *redaction) add(secret, name string) {
+	if len(secret) < minSecretLen || isReference(secret) {
+		return
+	}
+	if _, ok := d.placeholders[secret]; ok {
+		return
+	}
+	d.names[name]++
+	placeholder := "<" + name + ">"
+	if n := d.names[name]; n > 1 {
+		placeholder = fmt.Sprintf("<%s %d>", name, n)
+	}
+	d.secrets[placeholder] = secret
+	d.placeholders[secret] = placeholder
+}
+
+// replace replaces the known secrets in the text, longest first, so that
+// secrets containing others are replaced whole.
+func (d *redaction) replace(text string) string {
+	if len(d.placeholders) == 0 {
+		return text
+	}
+	secrets := make([]string, 0, len(d.placeholders))
+	for s := range d.placeholders {
+		secrets = append(secrets, s)
+	}
+	slices.SortFunc(secrets, func(a, b string) int {
+		return cmp.Or(cmp.Compare(len(b), len(a)), strings.Compare(a, b))
+	})
+	pairs := make([]string, 0, 2*len(secrets))
+	for _, s := range secrets {
+		pairs = append(pairs, s, d.placeholders[s])
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// isReference returns whether the value refers to a secret instead of being
+// one, like environment variables and placeholders.
+func isReference(value string) bool {
+	return strings.HasPrefix(value, "$") || placeholderRe.FindString(value) == value
+}
+
+// isHighEntropy returns whether the string looks randomly generated: long,
+// mixing lower and upper case letters with digits, and with a high Shannon
+// entropy. Hex strings, like commit hashes and UUIDs, don't qualify.
+func isHighEntropy(s string) bool {
+	if len(s) < minEntropyLen {
+		return false
+	}
+	var lower, upper, digit bool
+	counts := make(map[rune]int)
+	for _, r := range s {
+		lower = lower || unicode.IsLower(r)
+		upper = upper || unicode.IsUpper(r)
+		digit = digit || unicode.IsDigit(r)
+		counts[r]++
+	}
+	if !lower || !upper || !digit {
+		return false
+	}
+	var entropy float64
+	for _, n := range counts {
+		p := float64(n) / float64(len(s))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy >= minEntropy
+}
@@ -0,0 +1,84 @@
+package ctrl
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Limits of the input sample included in the prompt.
+const (
+	maxSampleBytes   = 4 << 10
+	maxSampleLines   = 50
+	maxSampleLineLen = 300
+)
+
+var ansiEscapeRe = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]`)
+
+// InputSample reads a sample of the input of a command, to show the model its
+// format. At most a few KiB are read from r.
+//
+// The sample is truncated, stripped of control characters, redacted of common
+// secrets and fenced, so that it can't be mistaken for the rest of the
+// prompt. An empty string is returned for empty input.
+func InputSample(r io.Reader) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxSampleBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("reading input sample: %w", err)
+	}
+	truncated := len(data) > maxSampleBytes
+	if truncated {
+		data = data[:maxSampleBytes]
+		// Avoid partial lines.
+		if i := strings.LastIndexByte(string(data), '\n'); i > 0 {
+			data = data[:i]
+		}
+	}
+
+	text := strings.ToValidUTF8(string(data), "")
+	text = ansiEscapeRe.ReplaceAllString(text, "")
+	text = strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' || !unicode.IsControl(r) {
+			return r
+		}
+		return -1
+	}, text)
+
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	if len(lines) > maxSampleLines {
+		lines = lines[:maxSampleLines]
+		truncated = true
+	}
+	for i, line := range lines {
+		if utf8.RuneCountInString(line) > maxSampleLineLen {
+			lines[i] = string([]rune(line)[:maxSampleLineLen]) + "..."
+		}
+	}
+	text = redactSecrets(strings.Join(lines, "\n"))
+	if strings.TrimSpace(text) == "" {
+		return "", nil
+	}
+	if truncated {
+		text += "\n[truncated]"
+	}
+	return fence(text), nil
+}
+
+// fence wraps the text in a code fence longer than any run of backticks it
+// contains, so that the text can't terminate it.
+func fence(text string) string {
+	longest, run := 0, 0
+	for _, r := range text {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	f := strings.Repeat("`", max(3, longest+1))
+	return f + "\n" + text + "\n" + f
+}
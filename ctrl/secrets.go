@@ -0,0 +1,63 @@
+package ctrl
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/mbrt/gencmd/config"
+)
+
+// secretCache holds the output of secret commands for the lifetime of the
+// process, so that each command runs at most once.
+var secretCache sync.Map
+
+// apiKey returns the API key for the provider, in order of precedence from:
+// the command configured in cfg.APIKeyCommand, the envVar environment
+// variable, or the command in its _COMMAND variant (e.g.
+// GEMINI_API_KEY_COMMAND). An empty key is returned if none is set.
+func apiKey(cfg config.LLMConfig, envVar string) (string, error) {
+	if cfg.APIKeyCommand != "" {
+		return runSecretCommand(cfg.APIKeyCommand)
+	}
+	if key := os.Getenv(envVar); key != "" {
+		return key, nil
+	}
+	opt := config.ProviderOption{EnvVar: envVar, Secret: true}
+	if command := os.Getenv(opt.CommandEnvVar()); command != "" {
+		return runSecretCommand(command)
+	}
+	return "", nil
+}
+
+// runSecretCommand runs the command through the shell and returns its output
+// with surrounding whitespace removed.
+//
+// The output is a secret, so it is never part of returned errors.
+func runSecretCommand(command string) (string, error) {
+	if v, ok := secretCache.Load(command); ok {
+		return v.(string), nil
+	}
+
+	var stdout, stderr bytes.Buffer
+	c := exec.Command("sh", "-c", command)
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+	if err := c.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return "", fmt.Errorf("running secret command %q: %w", command, err)
+		}
+		return "", fmt.Errorf("running secret command %q: %w: %s", command, err, msg)
+	}
+	secret := strings.TrimSpace(stdout.String())
+	if secret == "" {
+		return "", fmt.Errorf("secret command %q returned no output", command)
+	}
+
+	secretCache.Store(command, secret)
+	return secret, nil
+}
@@ -0,0 +1,84 @@
+package ctrl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mbrt/gencmd/config"
+)
+
+func TestAPIKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.LLMConfig
+		env     map[string]string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "not set",
+		},
+		{
+			name: "env var",
+			env:  map[string]string{"TEST_API_KEY": "from-env"},
+			want: "from-env",
+		},
+		{
+			name: "env command",
+			env:  map[string]string{"TEST_API_KEY_COMMAND": "echo ' from-env-command '"},
+			want: "from-env-command",
+		},
+		{
+			name: "config command wins",
+			cfg:  config.LLMConfig{APIKeyCommand: "echo from-config"},
+			env:  map[string]string{"TEST_API_KEY": "from-env"},
+			want: "from-config",
+		},
+		{
+			name:    "failing command",
+			cfg:     config.LLMConfig{APIKeyCommand: "echo $((6*7)); echo denied >&2; exit 1"},
+			wantErr: "denied",
+		},
+		{
+			name:    "empty output",
+			cfg:     config.LLMConfig{APIKeyCommand: "true"},
+			wantErr: "returned no output",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			got, err := apiKey(tt.cfg, "TEST_API_KEY")
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				// The output of the command must never leak.
+				assert.NotContains(t, err.Error(), "42")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSecretCommandCached(t *testing.T) {
+	counter := filepath.Join(t.TempDir(), "counter")
+	command := "echo run >> " + counter + "; echo secret"
+
+	for range 3 {
+		got, err := runSecretCommand(command)
+		require.NoError(t, err)
+		assert.Equal(t, "secret", got)
+	}
+
+	b, err := os.ReadFile(counter)
+	require.NoError(t, err)
+	assert.Equal(t, "run\n", string(b))
+}
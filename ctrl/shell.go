@@ -0,0 +1,137 @@
+package ctrl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// checkTimeout bounds the time spent checking the syntax of a command.
+const checkTimeout = 2 * time.Second
+
+// Shell is a shell that commands are generated for.
+type Shell string
+
+const (
+	ShellBash    Shell = "bash"
+	ShellZsh     Shell = "zsh"
+	ShellFish    Shell = "fish"
+	ShellNushell Shell = "nushell"
+	ShellPwsh    Shell = "pwsh"
+)
+
+// Shells lists all the supported shells.
+var Shells = []Shell{ShellBash, ShellZsh, ShellFish, ShellNushell, ShellPwsh}
+
+// ParseShell returns the shell with the given name or executable path (e.g.
+// /usr/bin/fish, nu or powershell).
+func ParseShell(name string) (Shell, error) {
+	base := strings.TrimSuffix(filepath.Base(name), ".exe")
+	switch strings.ToLower(base) {
+	case "bash", "sh":
+		return ShellBash, nil
+	case "zsh":
+		return ShellZsh, nil
+	case "fish":
+		return ShellFish, nil
+	case "nu", "nushell":
+		return ShellNushell, nil
+	case "pwsh", "powershell":
+		return ShellPwsh, nil
+	default:
+		return "", fmt.Errorf("unsupported shell %q", name)
+	}
+}
+
+// DetectShell returns the user's shell, based on the SHELL environment
+// variable. Bash is returned if the shell is unknown.
+func DetectShell() Shell {
+	if s, err := ParseShell(os.Getenv("SHELL")); err == nil {
+		return s
+	}
+	return ShellBash
+}
+
+// DisplayName returns the name of the shell used in prompts.
+func (s Shell) DisplayName() string {
+	switch s {
+	case ShellNushell:
+		return "Nushell"
+	case ShellPwsh:
+		return "PowerShell"
+	default:
+		return string(s)
+	}
+}
+
+// Check verifies that the command is syntactically valid for the shell,
+// without executing it. The shell itself is used as the parser, so nil is
+// returned when it is not installed.
+func (s Shell) Check(command string) error {
+	var (
+		name string
+		args []string
+	)
+	switch s {
+	case ShellBash, ShellZsh:
+		name, args = string(s), []string{"-n", "-c", command}
+	case ShellFish:
+		name, args = "fish", []string{"--no-execute", "-c", command}
+	case ShellNushell:
+		name, args = "nu", []string{"--no-config-file", "-c", "$env.GENCMD_CHECK | nu-check --debug"}
+	case ShellPwsh:
+		name, args = "pwsh", []string{"-NoProfile", "-NonInteractive", "-Command", pwshCheckScript}
+	default:
+		return fmt.Errorf("unsupported shell %q", s)
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	c := exec.CommandContext(ctx, path, args...)
+	c.Env = append(os.Environ(), "GENCMD_CHECK="+command)
+	c.Stdout = &stderr
+	c.Stderr = &stderr
+	err = c.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		// Do not reject commands just because the shell is slow.
+		return nil
+	}
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return fmt.Errorf("invalid %s syntax: %s", s.DisplayName(), msg)
+	}
+	return nil
+}
+
+const pwshCheckScript = `$errs = $null
+[void][System.Management.Automation.Language.Parser]::ParseInput($env:GENCMD_CHECK, [ref]$null, [ref]$errs)
+if ($errs) { $errs | ForEach-Object { $_.Message }; exit 1 }`
+
+// checkCommands checks the syntax of each command for the shell and reports
+// the problems as warnings. Placeholders, like <username>, are checked as
+// plain words, as they are filled in before running the command.
+func checkCommands(s Shell, commands []string) []GeneratedCommand {
+	res := make([]GeneratedCommand, len(commands))
+	for i, c := range commands {
+		res[i] = GeneratedCommand{Command: c}
+		if err := s.Check(withoutPlaceholders(c)); err != nil {
+			res[i].Warnings = append(res[i].Warnings, err.Error())
+		}
+	}
+	return res
+}
@@ -0,0 +1,73 @@
+package ctrl
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseShell(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Shell
+		wantErr bool
+	}{
+		{name: "bash", want: ShellBash},
+		{name: "/bin/zsh", want: ShellZsh},
+		{name: "/usr/local/bin/fish", want: ShellFish},
+		{name: "nu", want: ShellNushell},
+		{name: "nushell", want: ShellNushell},
+		{name: "powershell.exe", want: ShellPwsh},
+		{name: "tcsh", wantErr: true},
+		{name: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseShell(tt.name)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDetectShell(t *testing.T) {
+	t.Setenv("SHELL", "/usr/bin/fish")
+	assert.Equal(t, ShellFish, DetectShell())
+	t.Setenv("SHELL", "/bin/tcsh")
+	assert.Equal(t, ShellBash, DetectShell())
+}
+
+func TestShellCheck(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not installed")
+	}
+	assert.NoError(t, ShellBash.Check(`find . -name "*.go" | xargs wc -l`))
+	assert.ErrorContains(t, ShellBash.Check(`for f in *; do echo "$f"`), "invalid bash syntax")
+
+	checked := checkCommands(ShellBash, []string{`echo "unterminated`, `ls -l`, `pkill -u <username>`})
+	require.Len(t, checked, 3)
+	assert.Len(t, checked[0].Warnings, 1)
+	assert.Empty(t, checked[1].Warnings)
+	// Placeholders are not redirections.
+	assert.Empty(t, checked[2].Warnings)
+}
+
+func TestShellCheckMissingShell(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	assert.NoError(t, ShellFish.Check("not ( valid"))
+}
+
+func TestTemplatePrompt(t *testing.T) {
+	got, err := templatePrompt("Generate {{.Shell}} commands for: {{.UserInput}}", PromptInput{
+		UserInput: "list files",
+		Shell:     ShellPwsh.DisplayName(),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Generate PowerShell commands for: list files", got)
+}
@@ -0,0 +1,288 @@
+package ctrl
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adrg/xdg"
+)
+
+// ShellCommand is a command found in the history of a shell.
+type ShellCommand struct {
+	Command string
+	// Timestamp is when the command was last run, if the shell recorded it.
+	Timestamp time.Time
+	// Count is the number of times the command was run.
+	Count int
+}
+
+// ShellHistoryPath returns the default path of the history file of the shell.
+func ShellHistoryPath(s Shell) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	switch s {
+	case ShellBash:
+		return filepath.Join(home, ".bash_history"), nil
+	case ShellZsh:
+		dir := os.Getenv("ZDOTDIR")
+		if dir == "" {
+			dir = home
+		}
+		return filepath.Join(dir, ".zsh_history"), nil
+	case ShellFish:
+		return filepath.Join(xdg.DataHome, "fish", "fish_history"), nil
+	default:
+		return "", fmt.Errorf("importing %s history is not supported", s.DisplayName())
+	}
+}
+
+// ParseShellHistory returns the commands in the history file of the shell, in
+// the order they were run. Bash timestamps (HISTTIMEFORMAT), zsh extended
+// history and fish history are supported.
+func ParseShellHistory(r io.Reader, s Shell) ([]ShellCommand, error) {
+	switch s {
+	case ShellBash:
+		return parseBashHistory(r)
+	case ShellZsh:
+		return parseZshHistory(r)
+	case ShellFish:
+		return parseFishHistory(r)
+	default:
+		return nil, fmt.Errorf("importing %s history is not supported", s.DisplayName())
+	}
+}
+
+var bashTimestampRe = regexp.MustCompile(`^#(\d+)$`)
+
+func parseBashHistory(r io.Reader) ([]ShellCommand, error) {
+	var (
+		res []ShellCommand
+		ts  time.Time
+	)
+	scanner := newHistoryScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := bashTimestampRe.FindStringSubmatch(line); m != nil {
+			ts = parseUnix(m[1])
+			continue
+		}
+		if strings.TrimSpace(line) != "" {
+			res = append(res, ShellCommand{Command: line, Timestamp: ts, Count: 1})
+		}
+		ts = time.Time{}
+	}
+	return res, scanner.Err()
+}
+
+var zshExtendedRe = regexp.MustCompile(`^: (\d+):\d+;(.*)$`)
+
+func parseZshHistory(r io.Reader) ([]ShellCommand, error) {
+	var (
+		res     []ShellCommand
+		current *ShellCommand
+	)
+	scanner := newHistoryScanner(r)
+	for scanner.Scan() {
+		line := unmetafy(scanner.Text())
+		if current != nil {
+			// Continuation of a multi-line command.
+			current.Command += "\n" + line
+		} else {
+			cmd := ShellCommand{Command: line, Count: 1}
+			if m := zshExtendedRe.FindStringSubmatch(line); m != nil {
+				cmd.Timestamp = parseUnix(m[1])
+				cmd.Command = m[2]
+			}
+			res = append(res, cmd)
+			current = &res[len(res)-1]
+		}
+		if before, ok := strings.CutSuffix(current.Command, `\`); ok {
+			current.Command = before
+			continue
+		}
+		current = nil
+	}
+	res = slices.DeleteFunc(res, func(c ShellCommand) bool {
+		return strings.TrimSpace(c.Command) == ""
+	})
+	return res, scanner.Err()
+}
+
+// unmetafy decodes the bytes zsh escapes in its history file: 0x83 followed by
+// the byte xor 32.
+func unmetafy(s string) string {
+	if !strings.Contains(s, "\x83") {
+		return s
+	}
+	b := []byte(s)
+	var res []byte
+	for i := 0; i < len(b); i++ {
+		if b[i] == 0x83 && i+1 < len(b) {
+			i++
+			res = append(res, b[i]^32)
+			continue
+		}
+		res = append(res, b[i])
+	}
+	return string(res)
+}
+
+func parseFishHistory(r io.Reader) ([]ShellCommand, error) {
+	var res []ShellCommand
+	scanner := newHistoryScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if cmd, ok := strings.CutPrefix(line, "- cmd: "); ok {
+			res = append(res, ShellCommand{Command: unescapeFish(cmd), Count: 1})
+			continue
+		}
+		if when, ok := strings.CutPrefix(line, "  when: "); ok && len(res) > 0 {
+			res[len(res)-1].Timestamp = parseUnix(when)
+		}
+	}
+	return res, scanner.Err()
+}
+
+// unescapeFish decodes the escapes fish uses for commands in its history file.
+func unescapeFish(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			switch s[i+1] {
+			case 'n':
+				b.WriteByte('\n')
+				i++
+				continue
+			case '\\':
+				b.WriteByte('\\')
+				i++
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func newHistoryScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	// Shell history can contain long commands.
+	scanner.Buffer(nil, 1<<20)
+	return scanner
+}
+
+func parseUnix(s string) time.Time {
+	sec, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0).UTC()
+}
+
+// Commands not worth importing, unless combined with others.
+var trivialCommands = map[string]bool{
+	".": true, "bg": true, "cat": true, "cd": true, "clear": true,
+	"code": true, "echo": true, "emacs": true, "exit": true, "fg": true,
+	"gencmd": true, "history": true, "htop": true, "jobs": true, "la": true,
+	"less": true, "ll": true, "logout": true, "ls": true, "man": true,
+	"mkdir": true, "nano": true, "nvim": true, "open": true, "popd": true,
+	"pushd": true, "pwd": true, "reset": true, "source": true, "top": true,
+	"vi": true, "vim": true, "which": true,
+}
+
+// maxImportedLen is the length above which commands are considered pasted
+// scripts rather than something worth remembering.
+const maxImportedLen = 500
+
+// interestingCommand returns whether the command is worth importing: not a
+// trivial one (e.g. cd or ls), nor one containing secrets found by r.
+func interestingCommand(r *redactor, command string) bool {
+	if len(command) > maxImportedLen || r.hasSecrets(command) {
+		return false
+	}
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return false
+	}
+	if strings.ContainsAny(command, "|<>;`") || strings.Contains(command, "$(") || strings.Contains(command, "&&") {
+		return true
+	}
+	if trivialCommands[fields[0]] {
+		return false
+	}
+	var flags int
+	for _, f := range fields[1:] {
+		if strings.HasPrefix(f, "-") {
+			flags++
+		}
+	}
+	return len(fields) >= 4 || (len(fields) >= 3 && flags > 0)
+}
+
+// SelectShellCommands returns up to limit interesting commands, without
+// duplicates, the most frequently run first. Commands run the same number of
+// times are sorted from the most recent. Commands with secrets, according to
+// the redaction configuration, are skipped.
+func (c *Controller) SelectShellCommands(cmds []ShellCommand, limit int) ([]ShellCommand, error) {
+	r, err := c.getRedactor()
+	if err != nil {
+		return nil, err
+	}
+	return selectShellCommands(r, cmds, limit), nil
+}
+
+func selectShellCommands(r *redactor, cmds []ShellCommand, limit int) []ShellCommand {
+	type candidate struct {
+		ShellCommand
+		lastSeen int // For commands without timestamps.
+	}
+	index := make(map[string]int)
+	var candidates []candidate
+	for i, c := range cmds {
+		c.Command = strings.TrimSpace(c.Command)
+		if !interestingCommand(r, c.Command) {
+			continue
+		}
+		j, ok := index[c.Command]
+		if !ok {
+			index[c.Command] = len(candidates)
+			candidates = append(candidates, candidate{c, i})
+			continue
+		}
+		cd := &candidates[j]
+		cd.Count += c.Count
+		cd.lastSeen = i
+		if c.Timestamp.After(cd.Timestamp) {
+			cd.Timestamp = c.Timestamp
+		}
+	}
+
+	slices.SortFunc(candidates, func(a, b candidate) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		if c := b.Timestamp.Compare(a.Timestamp); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.lastSeen, a.lastSeen)
+	})
+	if limit > 0 && len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	res := make([]ShellCommand, len(candidates))
+	for i, c := range candidates {
+		res[i] = c.ShellCommand
+	}
+	return res
+}
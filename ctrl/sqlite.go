@@ -0,0 +1,276 @@
+package ctrl
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	// Pure Go SQLite driver, registered as "sqlite".
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema creates the tables of the SQLite store. Entries are stored as
+// JSON, with their prompt and command in separate columns for indexing and
+// full-text search, and their counters for aggregating the duplicates.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS history (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	prompt TEXT NOT NULL,
+	command TEXT NOT NULL,
+	entry TEXT NOT NULL,
+	use_count INTEGER NOT NULL DEFAULT 1,
+	runs INTEGER NOT NULL DEFAULT 0,
+	failures INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS history_key ON history (prompt, command);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS history_fts USING fts5(
+	prompt, command, content='history', content_rowid='id'
+);
+CREATE TRIGGER IF NOT EXISTS history_insert AFTER INSERT ON history BEGIN
+	INSERT INTO history_fts (rowid, prompt, command)
+	VALUES (new.id, new.prompt, new.command);
+END;
+CREATE TRIGGER IF NOT EXISTS history_delete AFTER DELETE ON history BEGIN
+	INSERT INTO history_fts (history_fts, rowid, prompt, command)
+	VALUES ('delete', old.id, old.prompt, old.command);
+END;
+
+CREATE TABLE IF NOT EXISTS rejected (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	entry TEXT NOT NULL
+);
+`
+
+// sqliteDistinct aggregates the duplicates of the entries, as dedupeHistory
+// does: the most recent duplicate, with the uses and runs of all of them,
+// and the details of the most recent run.
+const sqliteDistinct = `
+SELECT h.entry, d.use_count, d.runs, d.failures,
+	coalesce((SELECT json_extract(r.entry, '$.lastExitCode') FROM history r
+		WHERE r.prompt = d.prompt AND r.command = d.command AND r.runs > 0
+		ORDER BY r.id DESC LIMIT 1), 0),
+	coalesce((SELECT json_extract(r.entry, '$.lastDurationMs') FROM history r
+		WHERE r.prompt = d.prompt AND r.command = d.command AND r.runs > 0
+		ORDER BY r.id DESC LIMIT 1), 0)
+FROM (
+	SELECT prompt, command, max(id) AS last, sum(use_count) AS use_count,
+		sum(runs) AS runs, sum(failures) AS failures
+	FROM history GROUP BY prompt, command
+) d JOIN history h ON h.id = d.last
+ORDER BY d.last DESC
+`
+
+// sqliteStore keeps the history and the rejected entries in a SQLite
+// database. Duplicates are aggregated by the database when loading, deletes
+// and updates only touch the duplicates of the entry, through an index, and
+// searches go through a full-text index.
+type sqliteStore struct {
+	path string
+	db   *sql.DB
+}
+
+// openSQLiteStore opens the SQLite database at path, creating it if needed.
+func openSQLiteStore(path string) (*sqliteStore, error) {
+	// Wait for concurrent writers instead of failing right away.
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("opening history database: %w", err)
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("creating history database: %w", err)
+	}
+	return &sqliteStore{path: path, db: db}, nil
+}
+
+func (s *sqliteStore) Load() ([]HistoryEntry, error) {
+	return s.query(`SELECT entry FROM history ORDER BY id`)
+}
+
+// LoadDistinct returns the entries without duplicates, most recent first,
+// aggregating them in the database instead of loading all of them.
+func (s *sqliteStore) LoadDistinct() ([]HistoryEntry, error) {
+	rows, err := s.db.Query(sqliteDistinct)
+	if err != nil {
+		return nil, fmt.Errorf("reading history: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []HistoryEntry
+	for rows.Next() {
+		var (
+			data  string
+			entry HistoryEntry
+		)
+		if err := rows.Scan(&data, &entry.UseCount, &entry.Runs, &entry.Failures,
+			&entry.LastExitCode, &entry.LastDurationMs); err != nil {
+			return nil, err
+		}
+		counters := entry
+		if err := json.Unmarshal([]byte(data), &entry); err != nil {
+			continue // Skip malformed entries
+		}
+		entry.migrate()
+		entry.UseCount, entry.Runs, entry.Failures = counters.UseCount, counters.Runs, counters.Failures
+		entry.LastExitCode, entry.LastDurationMs = counters.LastExitCode, counters.LastDurationMs
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (s *sqliteStore) Append(entry HistoryEntry) error {
+	return insertEntries(s.db, []HistoryEntry{entry})
+}
+
+func (s *sqliteStore) Delete(entry HistoryEntry) error {
+	_, err := s.db.Exec(`DELETE FROM history WHERE prompt = ? AND command = ?`,
+		entry.Prompt, entry.Command)
+	if err != nil {
+		return fmt.Errorf("deleting history entry: %w", err)
+	}
+	return nil
+}
+
+func (s *sqliteStore) UpdateLast(entry HistoryEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshalling history entry: %w", err)
+	}
+	useCount, runs, failures := entryCounters(entry)
+	res, err := s.db.Exec(`UPDATE history SET entry = ?, use_count = ?, runs = ?, failures = ?
+		WHERE id = (SELECT max(id) FROM history WHERE prompt = ? AND command = ?)`,
+		string(data), useCount, runs, failures, entry.Prompt, entry.Command)
+	if err != nil {
+		return fmt.Errorf("updating history entry: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotInHistory
+	}
+	return nil
+}
+
+func (s *sqliteStore) Replace(entries []HistoryEntry) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // No-op after the commit.
+
+	if _, err := tx.Exec(`DELETE FROM history`); err != nil {
+		return fmt.Errorf("deleting history: %w", err)
+	}
+	if err := insertEntries(tx, entries); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) Reject(entry HistoryEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshalling rejected entry: %w", err)
+	}
+	if _, err := s.db.Exec(`INSERT INTO rejected (entry) VALUES (?)`, string(data)); err != nil {
+		return fmt.Errorf("inserting rejected entry: %w", err)
+	}
+	return nil
+}
+
+func (s *sqliteStore) Rejected() ([]HistoryEntry, error) {
+	return s.query(`SELECT entry FROM rejected ORDER BY id`)
+}
+
+// Search matches the words of the query as prefixes of the words in the
+// prompts and commands, ranking the entries with BM25.
+func (s *sqliteStore) Search(query string) ([]HistoryEntry, error) {
+	var terms []string
+	for _, w := range strings.Fields(query) {
+		// Quote the words, so that they are not interpreted as operators.
+		terms = append(terms, `"`+strings.ReplaceAll(w, `"`, `""`)+`"*`)
+	}
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	rows, err := s.db.Query(`SELECT prompt, command FROM history_fts
+		WHERE history_fts MATCH ? GROUP BY prompt, command ORDER BY min(rank)`,
+		strings.Join(terms, " "))
+	if err != nil {
+		return nil, fmt.Errorf("searching history: %w", err)
+	}
+	defer rows.Close()
+
+	var res []HistoryEntry
+	for rows.Next() {
+		var e HistoryEntry
+		if err := rows.Scan(&e.Prompt, &e.Command); err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+	return res, rows.Err()
+}
+
+// Lock serializes the changes of the controller, which read the history
+// before changing it, through a separate lock file. SQLite already protects
+// each single change.
+func (s *sqliteStore) Lock() (func(), error) {
+	return lockFile(s.path + ".lock")
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
+
+// query returns the entries in the JSON column of the rows returned by the
+// query, skipping the malformed ones.
+func (s *sqliteStore) query(query string) ([]HistoryEntry, error) {
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("reading history: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []HistoryEntry
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var entry HistoryEntry
+		if err := json.Unmarshal([]byte(data), &entry); err != nil {
+			continue // Skip malformed entries
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// execer is implemented by both sql.DB and sql.Tx.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func insertEntries(db execer, entries []HistoryEntry) error {
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("marshalling history entry: %w", err)
+		}
+		useCount, runs, failures := entryCounters(entry)
+		_, err = db.Exec(`INSERT INTO history (prompt, command, entry, use_count, runs, failures)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			entry.Prompt, entry.Command, string(data), useCount, runs, failures)
+		if err != nil {
+			return fmt.Errorf("inserting history entry: %w", err)
+		}
+	}
+	return nil
+}
+
+// entryCounters returns the counters of the entry, as of the current version.
+func entryCounters(entry HistoryEntry) (useCount, runs, failures int) {
+	entry.migrate()
+	return entry.UseCount, entry.Runs, entry.Failures
+}
@@ -0,0 +1,95 @@
+package ctrl
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+	"time"
+)
+
+// maxTopEntries is the number of entries in the top lists of HistoryStats.
+const maxTopEntries = 5
+
+// HistoryStats summarizes the history.
+type HistoryStats struct {
+	// Entries is the number of distinct commands in history.
+	Entries int `json:"entries"`
+	// Uses is the number of times commands were accepted.
+	Uses int `json:"uses"`
+	// Runs and Failures are the number of recorded executions and the number
+	// of them that failed.
+	Runs     int `json:"runs"`
+	Failures int `json:"failures"`
+	// First and Last are the oldest and most recent timestamps.
+	First time.Time `json:"first,omitzero"`
+	Last  time.Time `json:"last,omitzero"`
+	// Sources counts the uses by source (e.g. SourceGenerated).
+	Sources map[string]int `json:"sources,omitempty"`
+	// Models counts the generated uses by provider and model.
+	Models map[string]int `json:"models,omitempty"`
+	// TopCommands are the most used entries.
+	TopCommands []HistoryEntry `json:"topCommands,omitempty"`
+	// TopDirs are the directories commands were used in the most.
+	TopDirs []Count `json:"topDirs,omitempty"`
+}
+
+// Count is the number of occurrences of a value.
+type Count struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// HistoryStats returns statistics about the history.
+func (c *Controller) HistoryStats() HistoryStats {
+	raw, _ := c.loadHistoryRaw()
+	stats := HistoryStats{
+		Sources: make(map[string]int),
+		Models:  make(map[string]int),
+	}
+	dirs := make(map[string]int)
+	for _, e := range raw {
+		stats.Uses += e.UseCount
+		stats.Runs += e.Runs
+		stats.Failures += e.Failures
+		if !e.Timestamp.IsZero() {
+			if stats.First.IsZero() || e.Timestamp.Before(stats.First) {
+				stats.First = e.Timestamp
+			}
+			if e.Timestamp.After(stats.Last) {
+				stats.Last = e.Timestamp
+			}
+		}
+		if e.Source != "" {
+			stats.Sources[e.Source] += e.UseCount
+		}
+		if e.Model != "" {
+			stats.Models[e.Provider+"/"+e.Model] += e.UseCount
+		}
+		if e.Dir != "" {
+			dirs[e.Dir] += e.UseCount
+		}
+	}
+
+	slices.Reverse(raw)
+	history := dedupeHistory(raw)
+	stats.Entries = len(history)
+	slices.SortStableFunc(history, func(a, b HistoryEntry) int {
+		return cmp.Compare(b.UseCount, a.UseCount)
+	})
+	stats.TopCommands = history[:min(len(history), maxTopEntries)]
+	stats.TopDirs = topCounts(dirs, maxTopEntries)
+	return stats
+}
+
+// topCounts returns the n values with the highest counts, breaking ties by
+// value.
+func topCounts(counts map[string]int, n int) []Count {
+	var res []Count
+	for _, v := range slices.Sorted(maps.Keys(counts)) {
+		res = append(res, Count{Value: v, Count: counts[v]})
+	}
+	slices.SortStableFunc(res, func(a, b Count) int {
+		return cmp.Compare(b.Count, a.Count)
+	})
+	return res[:min(len(res), n)]
+}
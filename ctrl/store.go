@@ -0,0 +1,342 @@
+package ctrl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/adrg/xdg"
+
+	"github.com/mbrt/gencmd/config"
+)
+
+// History stores.
+const (
+	// StoreJSONL keeps the history in a JSON lines file, appending an entry
+	// for every use of a command.
+	StoreJSONL = "jsonl"
+	// StoreSQLite keeps the history in a SQLite database, with indexes and
+	// full-text search.
+	StoreSQLite = "sqlite"
+)
+
+// HistoryStore persists the history entries and the rejected ones.
+//
+// Entries are kept in the order they were added, with every use of a command
+// being a separate entry. Changes made by other processes are only prevented
+// while holding the lock.
+type HistoryStore interface {
+	// Load returns all the entries, in the order they were added.
+	Load() ([]HistoryEntry, error)
+	// Append adds the entry as the most recent one.
+	Append(entry HistoryEntry) error
+	// Delete removes all the duplicates of the entry.
+	Delete(entry HistoryEntry) error
+	// UpdateLast replaces the most recent duplicate of the entry with it.
+	UpdateLast(entry HistoryEntry) error
+	// Replace replaces all the entries with the given ones.
+	Replace(entries []HistoryEntry) error
+	// Reject logs the entry as rejected by the user.
+	Reject(entry HistoryEntry) error
+	// Rejected returns all the rejected entries, in the order they were
+	// rejected.
+	Rejected() ([]HistoryEntry, error)
+	// Lock locks the store against changes from other processes, and returns
+	// a function releasing the lock.
+	Lock() (func(), error)
+	// Close releases the resources of the store.
+	Close() error
+}
+
+// historyAggregator is implemented by the stores able to deduplicate the
+// history without loading all of its entries.
+type historyAggregator interface {
+	// LoadDistinct returns the entries without duplicates, most recent
+	// first, as dedupeHistory.
+	LoadDistinct() ([]HistoryEntry, error)
+}
+
+// historySearcher is implemented by the stores able to search the history
+// through an index.
+type historySearcher interface {
+	// Search returns the distinct entries whose prompt or command contain all
+	// the words of the query, best matches first.
+	Search(query string) ([]HistoryEntry, error)
+}
+
+// OpenHistoryStore opens the configured history store (e.g. StoreSQLite) in
+// the user's XDG data directory. When no store is configured, it opens the
+// default JSONL store.
+func OpenHistoryStore(cfg config.HistoryConfig) (HistoryStore, error) {
+	switch cfg.Store {
+	case "", StoreJSONL:
+		hpath, err := xdg.DataFile("gencmd/history.jsonl")
+		if err != nil {
+			return nil, err
+		}
+		rpath, err := xdg.DataFile("gencmd/rejected.jsonl")
+		if err != nil {
+			return nil, err
+		}
+		spath, err := xdg.DataFile("gencmd/history.salt")
+		if err != nil {
+			return nil, err
+		}
+		cipher, err := newHistoryCipher(cfg.Encryption, spath)
+		if err != nil {
+			return nil, fmt.Errorf("setting up history encryption: %w", err)
+		}
+		store := newJSONLStore(hpath, rpath)
+		store.cipher = cipher
+		return store, nil
+	case StoreSQLite:
+		if cfg.Encryption != (config.EncryptionConfig{}) {
+			return nil, fmt.Errorf("encryption is not supported by the %s store", StoreSQLite)
+		}
+		path, err := xdg.DataFile("gencmd/history.db")
+		if err != nil {
+			return nil, err
+		}
+		return openSQLiteStore(path)
+	default:
+		return nil, fmt.Errorf("unknown history store %q", cfg.Store)
+	}
+}
+
+// jsonlStore keeps the history and the rejected entries in two JSON lines
+// files.
+//
+// Entries are appended to the history file, while the other changes rewrite
+// it atomically. Reads don't need the lock, as they either see the file
+// before or after a rewrite.
+//
+// With a cipher, every line is encrypted on its own. Plain lines are still
+// read, so that encryption can be enabled on existing files.
+type jsonlStore struct {
+	historyPath  string
+	rejectedPath string
+	cipher       *historyCipher
+}
+
+// newJSONLStore returns a store keeping the history and the rejected entries
+// in the files at the given paths.
+func newJSONLStore(historyPath, rejectedPath string) *jsonlStore {
+	return &jsonlStore{
+		historyPath:  historyPath,
+		rejectedPath: rejectedPath,
+	}
+}
+
+func (s *jsonlStore) Load() ([]HistoryEntry, error) {
+	return readJSONL(s.historyPath, s.cipher)
+}
+
+func (s *jsonlStore) Append(entry HistoryEntry) error {
+	if err := appendJSONL(s.historyPath, entry, s.cipher); err != nil {
+		return fmt.Errorf("appending to history file: %w", err)
+	}
+	return nil
+}
+
+func (s *jsonlStore) Delete(entry HistoryEntry) error {
+	entries, err := s.Load()
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+	entries = slices.DeleteFunc(entries, func(e HistoryEntry) bool {
+		return e.key() == entry.key()
+	})
+	return s.Replace(entries)
+}
+
+func (s *jsonlStore) UpdateLast(entry HistoryEntry) error {
+	entries, err := s.Load()
+	if err != nil {
+		return err
+	}
+	i := lastIndexFunc(entries, func(e HistoryEntry) bool {
+		return e.key() == entry.key()
+	})
+	if i < 0 {
+		return ErrNotInHistory
+	}
+	entries[i] = entry
+	return s.Replace(entries)
+}
+
+func (s *jsonlStore) Replace(entries []HistoryEntry) error {
+	data, err := encodeJSONL(entries, s.cipher)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.historyPath, data)
+}
+
+func (s *jsonlStore) Reject(entry HistoryEntry) error {
+	if err := appendJSONL(s.rejectedPath, entry, s.cipher); err != nil {
+		return fmt.Errorf("appending to rejected file: %w", err)
+	}
+	return nil
+}
+
+func (s *jsonlStore) Rejected() ([]HistoryEntry, error) {
+	return readJSONL(s.rejectedPath, s.cipher)
+}
+
+// Lock locks the history and rejected files, through a separate lock file.
+func (s *jsonlStore) Lock() (func(), error) {
+	return lockFile(s.historyPath + ".lock")
+}
+
+func (s *jsonlStore) Close() error {
+	return nil
+}
+
+// readJSONL returns the entries in the JSON lines file at path, decrypting
+// the encrypted ones with the cipher and skipping the malformed ones. A missing
+// file has no entries.
+func readJSONL(path string, cipher *historyCipher) ([]HistoryEntry, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []HistoryEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if isEncrypted(line) {
+			if cipher == nil {
+				return nil, ErrHistoryEncrypted
+			}
+			if line, err = cipher.decrypt(line); err != nil {
+				return nil, fmt.Errorf("decrypting %s: %w", path, err)
+			}
+		}
+		var entry HistoryEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			continue // Skip malformed entries
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// encodeJSONL returns the entries encoded as JSON lines, encrypted with the
+// cipher if not nil.
+func encodeJSONL(entries []HistoryEntry, cipher *historyCipher) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		data, err := encodeEntry(entry, cipher)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// writeFileAtomic replaces the file at path with the data, so that readers
+// see either the old or the new content.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "tmp-history-*.jsonl")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Clean up temp file
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("writing to tmp history file: %w", err)
+	}
+	// Flush
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("syncing tmp history file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	// Rename tmp into the new file (which is atomic)
+	return os.Rename(tmp.Name(), path)
+}
+
+func appendJSONL(path string, entry HistoryEntry, cipher *historyCipher) error {
+	data, err := encodeEntry(entry, cipher)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// encodeEntry returns the JSON line of the entry, without the newline,
+// encrypted with the cipher if not nil.
+func encodeEntry(entry HistoryEntry, cipher *historyCipher) ([]byte, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling history entry: %w", err)
+	}
+	if cipher == nil {
+		return data, nil
+	}
+	data, err = cipher.encrypt(data)
+	if err != nil {
+		return nil, fmt.Errorf("encrypting history entry: %w", err)
+	}
+	return data, nil
+}
+
+// CopyHistory copies all the history and rejected entries from src to dst,
+// which must be empty. Both stores are locked during the copy.
+func CopyHistory(dst, src HistoryStore) error {
+	unlockSrc, err := src.Lock()
+	if err != nil {
+		return fmt.Errorf("locking source history: %w", err)
+	}
+	defer unlockSrc()
+	unlockDst, err := dst.Lock()
+	if err != nil {
+		return fmt.Errorf("locking destination history: %w", err)
+	}
+	defer unlockDst()
+
+	if existing, err := dst.Load(); err != nil {
+		return fmt.Errorf("reading destination history: %w", err)
+	} else if len(existing) > 0 {
+		return fmt.Errorf("destination history is not empty (%d entries)", len(existing))
+	}
+	entries, err := src.Load()
+	if err != nil {
+		return fmt.Errorf("reading source history: %w", err)
+	}
+	rejected, err := src.Rejected()
+	if err != nil {
+		return fmt.Errorf("reading source rejected entries: %w", err)
+	}
+
+	if err := dst.Replace(entries); err != nil {
+		return fmt.Errorf("writing history: %w", err)
+	}
+	for _, e := range rejected {
+		if err := dst.Reject(e); err != nil {
+			return fmt.Errorf("writing rejected entries: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package ctrl
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStores(t *testing.T) map[string]HistoryStore {
+	t.Helper()
+	dir := t.TempDir()
+	sqlite, err := openSQLiteStore(filepath.Join(dir, "history.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = sqlite.Close() })
+	return map[string]HistoryStore{
+		StoreJSONL:  newJSONLStore(filepath.Join(dir, "history.jsonl"), filepath.Join(dir, "rejected.jsonl")),
+		StoreSQLite: sqlite,
+	}
+}
+
+func TestHistoryStore(t *testing.T) {
+	for name, store := range newTestStores(t) {
+		t.Run(name, func(t *testing.T) {
+			entries, err := store.Load()
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+
+			for _, e := range []HistoryEntry{
+				{Prompt: "p1", Command: "c1"},
+				{Prompt: "p2", Command: "c2"},
+				{Prompt: "p1", Command: "c1"},
+				{Prompt: "p3", Command: "c3"},
+			} {
+				require.NoError(t, store.Append(e))
+			}
+			require.NoError(t, store.UpdateLast(HistoryEntry{Prompt: "p1", Command: "c1", Runs: 1}))
+			assert.ErrorIs(t, store.UpdateLast(HistoryEntry{Prompt: "p4", Command: "c4"}), ErrNotInHistory)
+			require.NoError(t, store.Delete(HistoryEntry{Prompt: "p2", Command: "c2"}))
+			require.NoError(t, store.Reject(HistoryEntry{Prompt: "p2", Command: "c2"}))
+
+			entries, err = store.Load()
+			require.NoError(t, err)
+			assert.Equal(t, []HistoryEntry{
+				{Prompt: "p1", Command: "c1"},
+				{Prompt: "p1", Command: "c1", Runs: 1},
+				{Prompt: "p3", Command: "c3"},
+			}, entries)
+			rejected, err := store.Rejected()
+			require.NoError(t, err)
+			assert.Equal(t, []HistoryEntry{{Prompt: "p2", Command: "c2"}}, rejected)
+
+			require.NoError(t, store.Replace([]HistoryEntry{{Prompt: "p5", Command: "c5"}}))
+			entries, err = store.Load()
+			require.NoError(t, err)
+			assert.Equal(t, []HistoryEntry{{Prompt: "p5", Command: "c5"}}, entries)
+		})
+	}
+}
+
+func TestSQLiteLoadDistinct(t *testing.T) {
+	store, err := openSQLiteStore(filepath.Join(t.TempDir(), "history.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	for _, e := range []HistoryEntry{
+		{Version: historyVersion, Prompt: "p1", Command: "c1", UseCount: 1},
+		{Version: historyVersion, Prompt: "p2", Command: "c2", UseCount: 1, Runs: 2, Failures: 1, LastExitCode: 1},
+		{Version: historyVersion, Prompt: "p1", Command: "c1", UseCount: 2, Runs: 1, LastDurationMs: 10},
+		{Version: historyVersion, Prompt: "p2", Command: "c2", UseCount: 1, Dir: "/tmp"},
+	} {
+		require.NoError(t, store.Append(e))
+	}
+	require.NoError(t, store.UpdateLast(HistoryEntry{
+		Version: historyVersion, Prompt: "p1", Command: "c1", UseCount: 2, Runs: 2, LastDurationMs: 20,
+	}))
+
+	// The database aggregates the duplicates like dedupeHistory.
+	raw, err := store.Load()
+	require.NoError(t, err)
+	for i := range raw {
+		raw[i].migrate()
+	}
+	slices.Reverse(raw)
+	got, err := store.LoadDistinct()
+	require.NoError(t, err)
+	assert.Equal(t, dedupeHistory(raw), got)
+	assert.Equal(t, []HistoryEntry{
+		{Version: historyVersion, Prompt: "p2", Command: "c2", UseCount: 2, Runs: 2, Failures: 1, LastExitCode: 1, Dir: "/tmp"},
+		{Version: historyVersion, Prompt: "p1", Command: "c1", UseCount: 3, Runs: 2, LastDurationMs: 20},
+	}, got)
+}
+
+func TestSQLiteSearch(t *testing.T) {
+	store, err := openSQLiteStore(filepath.Join(t.TempDir(), "history.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	require.NoError(t, store.Replace([]HistoryEntry{
+		{Prompt: "find all jpg files", Command: "find . -name '*.jpg'"},
+		{Prompt: "list files", Command: "ls -la"},
+		{Prompt: "find all jpg files", Command: "find . -name '*.jpg'"},
+		{Prompt: "count lines", Command: "wc -l \"file\""},
+	}))
+
+	tests := []struct {
+		query string
+		want  []HistoryEntry
+	}{
+		{
+			query: "find jp",
+			want:  []HistoryEntry{{Prompt: "find all jpg files", Command: "find . -name '*.jpg'"}},
+		},
+		{
+			query: "files",
+			want: []HistoryEntry{
+				{Prompt: "list files", Command: "ls -la"},
+				{Prompt: "find all jpg files", Command: "find . -name '*.jpg'"},
+			},
+		},
+		{
+			// Operators and quotes are matched literally.
+			query: `"file" OR`,
+		},
+		{
+			query: "xyz",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.query, func(t *testing.T) {
+			got, err := store.Search(tc.query)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestSearchHistorySQLite(t *testing.T) {
+	store, err := openSQLiteStore(filepath.Join(t.TempDir(), "history.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	controller := &Controller{store: store}
+	require.NoError(t, controller.UpdateHistory("find all jpg files", "find . -name '*.jpg'", SourceGenerated))
+	require.NoError(t, controller.UpdateHistory("list files", "ls -la", SourceGenerated))
+
+	// Full-text matches.
+	assert.Equal(t, []HistoryEntry{{Prompt: "list files", Command: "ls -la", UseCount: 1}},
+		withoutMetadata(controller.SearchHistory("list")))
+	// Falls back to fuzzy matching.
+	assert.Equal(t, []HistoryEntry{{Prompt: "find all jpg files", Command: "find . -name '*.jpg'", UseCount: 1}},
+		withoutMetadata(controller.SearchHistory("fjpg")))
+	assert.Empty(t, controller.MatchHistory("fjpg"))
+	assert.Equal(t, []HistoryEntry{{Prompt: "find all jpg files", Command: "find . -name '*.jpg'", UseCount: 1}},
+		withoutMetadata(controller.MatchHistory("find jpg")))
+}
+
+func TestCopyHistory(t *testing.T) {
+	stores := newTestStores(t)
+	src, dst := stores[StoreJSONL], stores[StoreSQLite]
+	entries := []HistoryEntry{
+		{Prompt: "p1", Command: "c1", UseCount: 1},
+		{Prompt: "p2", Command: "c2", UseCount: 1},
+		{Prompt: "p1", Command: "c1", UseCount: 1, Runs: 2},
+	}
+	require.NoError(t, src.Replace(entries))
+	require.NoError(t, src.Reject(HistoryEntry{Prompt: "p3", Command: "c3"}))
+
+	require.NoError(t, CopyHistory(dst, src))
+	got, err := dst.Load()
+	require.NoError(t, err)
+	assert.Equal(t, entries, got)
+	rejected, err := dst.Rejected()
+	require.NoError(t, err)
+	assert.Equal(t, []HistoryEntry{{Prompt: "p3", Command: "c3"}}, rejected)
+
+	// The destination must be empty.
+	assert.ErrorContains(t, CopyHistory(dst, src), "not empty")
+}
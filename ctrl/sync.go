@@ -0,0 +1,458 @@
+package ctrl
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Suffixes of the files each machine writes in the sync directory.
+const (
+	syncHistorySuffix  = ".history.jsonl"
+	syncRejectedSuffix = ".rejected.jsonl"
+	syncSaltSuffix     = ".salt"
+)
+
+// SyncOptions configure the synchronization of the history with other
+// machines.
+type SyncOptions struct {
+	// Dir is the directory shared with the other machines, e.g. through
+	// Syncthing or NFS, or a clone of a git repository.
+	Dir string
+	// Host names the files of this machine in Dir.
+	Host string
+}
+
+// SyncStats counts the changes made to the history by a synchronization.
+type SyncStats struct {
+	// Added entries came from other machines.
+	Added int `json:"added"`
+	// Merged entries were updated with the details from other machines.
+	Merged int `json:"merged"`
+	// Deleted entries were deleted on other machines.
+	Deleted int `json:"deleted"`
+	// Published tells whether the files of this machine in the sync
+	// directory changed.
+	Published bool `json:"published"`
+	// Skipped lists the files of other machines that couldn't be decrypted,
+	// e.g. because they are encrypted with another identity or passphrase.
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+// SyncHistory merges the history with the one of the other machines sharing
+// the sync directory, and publishes the result there.
+//
+// Each machine only writes its own files: the merged history, and the
+// tombstones of the deleted entries. The history is merged record by record,
+// so that the uses made on every machine add up, and the records deleted
+// anywhere are removed, unless they are more recent than the deletion. The
+// result doesn't depend on the order the files are read, and syncing again
+// without changes has no effect.
+//
+// If the directory is a git repository, the files are committed, and pulled
+// and pushed when the current branch has an upstream.
+func (c *Controller) SyncHistory(opts SyncOptions) (SyncStats, error) {
+	if opts.Dir == "" {
+		return SyncStats{}, fmt.Errorf("sync directory is not set")
+	}
+	store, unlock, err := c.lockHistory()
+	if err != nil {
+		return SyncStats{}, err
+	}
+	defer unlock()
+
+	repo := isGitRepo(opts.Dir)
+	upstream := repo && hasUpstream(opts.Dir)
+	if upstream {
+		if _, err := runGit(opts.Dir, "pull", "--rebase", "--quiet"); err != nil {
+			return SyncStats{}, err
+		}
+	}
+	if err := os.MkdirAll(opts.Dir, 0o700); err != nil {
+		return SyncStats{}, fmt.Errorf("creating sync directory: %w", err)
+	}
+
+	local, _, err := c.loadHistory()
+	if err != nil {
+		return SyncStats{}, err
+	}
+	localRejected, err := store.Rejected()
+	if err != nil {
+		return SyncStats{}, fmt.Errorf("reading rejected entries: %w", err)
+	}
+	// The files in the sync directory are encrypted like the history.
+	cipher := storeCipher(store)
+	remote, remoteRejected, skipped, err := readSyncDir(opts.Dir, cipher)
+	if err != nil {
+		return SyncStats{}, err
+	}
+
+	tombstones := mergeTombstones(localRejected, remoteRejected)
+	merged := slices.DeleteFunc(mergeRecords(append(remote, local)...), func(e HistoryEntry) bool {
+		t, ok := tombstones[e.key()]
+		return ok && !e.Timestamp.After(t.deletedAt())
+	})
+	stats := diffHistory(compactHistory(local), compactHistory(merged))
+	stats.Skipped = skipped
+	if !slices.EqualFunc(local, merged, sameRecord) {
+		if err := store.Replace(merged); err != nil {
+			return stats, fmt.Errorf("writing history: %w", err)
+		}
+	}
+	// Keep the tombstones from other machines, so that they are not lost
+	// when their files are.
+	known := mergeTombstones(localRejected, nil)
+	for _, t := range sortedTombstones(tombstones) {
+		if k, ok := known[t.key()]; !ok || k.deletedAt().Before(t.deletedAt()) {
+			if err := store.Reject(t); err != nil {
+				return stats, fmt.Errorf("writing rejected entries: %w", err)
+			}
+		}
+	}
+
+	base := filepath.Join(opts.Dir, syncFileName(opts.Host))
+	changedHistory, err := writeIfChanged(base+syncHistorySuffix, merged, cipher)
+	if err != nil {
+		return stats, err
+	}
+	changedRejected, err := writeIfChanged(base+syncRejectedSuffix, sortedTombstones(tombstones), cipher)
+	if err != nil {
+		return stats, err
+	}
+	changedSalt, err := publishSalt(base+syncSaltSuffix, cipher)
+	if err != nil {
+		return stats, err
+	}
+	stats.Published = changedHistory || changedRejected || changedSalt
+
+	if repo && stats.Published {
+		if err := commitSync(opts.Dir, base, opts.Host); err != nil {
+			return stats, err
+		}
+	}
+	if upstream {
+		if _, err := runGit(opts.Dir, "push", "--quiet"); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+// readSyncDir returns the history of each of the machines in the sync
+// directory, and all their rejected entries, in the order of their file
+// names. Files that can't be decrypted are skipped, and returned separately.
+//
+// The files of each machine are decrypted with the salt it published, if
+// any, as the identity derived from the same passphrase differs with it.
+func readSyncDir(dir string, cipher *historyCipher) (history [][]HistoryEntry, rejected []HistoryEntry, skipped []string, err error) {
+	ciphers := make(map[string]*historyCipher)
+	for _, suffix := range []string{syncHistorySuffix, syncRejectedSuffix} {
+		paths, err := filepath.Glob(filepath.Join(dir, "*"+suffix))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		slices.Sort(paths)
+		for _, path := range paths {
+			salt, err := readSalt(strings.TrimSuffix(path, suffix) + syncSaltSuffix)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			fileCipher, ok := ciphers[string(salt)]
+			if !ok {
+				if fileCipher, err = cipher.withSalt(salt); err != nil {
+					return nil, nil, nil, err
+				}
+				ciphers[string(salt)] = fileCipher
+			}
+			entries, err := readJSONL(path, fileCipher)
+			if isUndecryptable(err) {
+				skipped = append(skipped, path)
+				continue
+			}
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("reading %s: %w", path, err)
+			}
+			for i := range entries {
+				entries[i].migrate()
+			}
+			if suffix == syncHistorySuffix {
+				history = append(history, entries)
+			} else {
+				rejected = append(rejected, entries...)
+			}
+		}
+	}
+	return history, rejected, skipped, nil
+}
+
+// mergeRecords merges the history records of several machines, and returns
+// them sorted by compareEntries. Copies of the same record are merged by
+// taking their largest counters, and a record appearing several times in a
+// history appears as many times in the result. The result is the same
+// regardless of the order of the histories.
+func mergeRecords(histories ...[]HistoryEntry) []HistoryEntry {
+	merged := make(map[HistoryEntry][]HistoryEntry)
+	for _, h := range histories {
+		copies := make(map[HistoryEntry]int)
+		for _, e := range h {
+			id := e.recordID()
+			n := copies[id]
+			copies[id]++
+			if n < len(merged[id]) {
+				merged[id][n].absorbRecord(e)
+			} else {
+				merged[id] = append(merged[id], e)
+			}
+		}
+	}
+	var res []HistoryEntry
+	for _, records := range merged {
+		res = append(res, records...)
+	}
+	slices.SortFunc(res, compareEntries)
+	return res
+}
+
+// recordID identifies the copies of a history record in the histories of
+// different machines, which only differ in the counters of the runs made
+// after they were copied.
+func (e HistoryEntry) recordID() HistoryEntry {
+	e.Timestamp = e.Timestamp.UTC()
+	e.UseCount, e.Runs, e.Failures = 0, 0, 0
+	e.LastExitCode, e.LastDurationMs = 0, 0
+	return e
+}
+
+// absorbRecord merges a copy of the same record, keeping the largest
+// counters and the details of the last run of the copy with more runs.
+func (e *HistoryEntry) absorbRecord(other HistoryEntry) {
+	details := cmp.Or(
+		cmp.Compare(other.Runs, e.Runs),
+		cmp.Compare(other.LastExitCode, e.LastExitCode),
+		cmp.Compare(other.LastDurationMs, e.LastDurationMs),
+	)
+	if details > 0 {
+		e.LastExitCode, e.LastDurationMs = other.LastExitCode, other.LastDurationMs
+	}
+	e.UseCount = max(e.UseCount, other.UseCount)
+	e.Runs = max(e.Runs, other.Runs)
+	e.Failures = max(e.Failures, other.Failures)
+}
+
+func sameRecord(a, b HistoryEntry) bool {
+	return a.recordID() == b.recordID() && a.UseCount == b.UseCount && a.Runs == b.Runs &&
+		a.Failures == b.Failures && a.LastExitCode == b.LastExitCode && a.LastDurationMs == b.LastDurationMs
+}
+
+// compactHistory returns the history records, given from the least recent,
+// deduplicated and sorted by sortHistory.
+func compactHistory(records []HistoryEntry) []HistoryEntry {
+	records = slices.Clone(records)
+	slices.Reverse(records)
+	res := dedupeHistory(records)
+	sortHistory(res)
+	return res
+}
+
+// mergeTombstones returns the most recent deletion of each of the rejected
+// entries.
+func mergeTombstones(lists ...[]HistoryEntry) map[historyKey]HistoryEntry {
+	res := make(map[historyKey]HistoryEntry)
+	for _, list := range lists {
+		for _, e := range list {
+			t, ok := res[e.key()]
+			if !ok || t.deletedAt().Before(e.deletedAt()) ||
+				(t.deletedAt().Equal(e.deletedAt()) && compareEntries(e, t) < 0) {
+				res[e.key()] = e
+			}
+		}
+	}
+	return res
+}
+
+func sortedTombstones(tombstones map[historyKey]HistoryEntry) []HistoryEntry {
+	res := make([]HistoryEntry, 0, len(tombstones))
+	for _, t := range tombstones {
+		res = append(res, t)
+	}
+	slices.SortFunc(res, func(a, b HistoryEntry) int {
+		return cmp.Or(a.deletedAt().Compare(b.deletedAt()), compareEntries(a, b))
+	})
+	return res
+}
+
+// deletedAt returns when the rejected entry was deleted. Entries rejected
+// before the time was recorded were deleted at their last use.
+func (e HistoryEntry) deletedAt() time.Time {
+	if !e.RejectedAt.IsZero() {
+		return e.RejectedAt
+	}
+	return e.Timestamp
+}
+
+// sortHistory sorts the deduplicated history from the least recently used.
+func sortHistory(entries []HistoryEntry) {
+	slices.SortFunc(entries, func(a, b HistoryEntry) int {
+		return cmp.Or(
+			a.Timestamp.Compare(b.Timestamp),
+			strings.Compare(a.Prompt, b.Prompt),
+			strings.Compare(a.Command, b.Command),
+		)
+	})
+}
+
+// compareEntries is a total order of the entries, by timestamp first.
+func compareEntries(a, b HistoryEntry) int {
+	if c := a.Timestamp.Compare(b.Timestamp); c != 0 {
+		return c
+	}
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return bytes.Compare(ja, jb)
+}
+
+// diffHistory counts the changes from the old to the new history.
+func diffHistory(old, updated []HistoryEntry) SyncStats {
+	before := make(map[historyKey]HistoryEntry, len(old))
+	for _, e := range old {
+		before[e.key()] = e
+	}
+	var stats SyncStats
+	for _, e := range updated {
+		o, ok := before[e.key()]
+		switch {
+		case !ok:
+			stats.Added++
+		case o != e:
+			stats.Merged++
+		}
+		delete(before, e.key())
+	}
+	stats.Deleted = len(before)
+	return stats
+}
+
+// syncFileName returns the base name of the files of the host, with only
+// characters safe in file names.
+func syncFileName(host string) string {
+	name := unsafeFileChars.ReplaceAllString(host, "_")
+	if name == "" {
+		return "unknown"
+	}
+	return name
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// writeIfChanged writes the entries to the file at path, unless it already
+// contains them. It returns whether the file was written.
+func writeIfChanged(path string, entries []HistoryEntry, cipher *historyCipher) (bool, error) {
+	// Encrypted records differ at every encryption, so the entries are
+	// compared instead of the data. Files that can't be decrypted anymore
+	// (e.g. after changing passphrase) are rewritten.
+	old, err := readJSONL(path, cipher)
+	switch {
+	case isUndecryptable(err):
+	case err != nil:
+		return false, err
+	default:
+		if _, err := os.Stat(path); err == nil && slices.Equal(old, entries) {
+			return false, nil
+		}
+	}
+	data, err := encodeJSONL(entries, cipher)
+	if err != nil {
+		return false, err
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return false, fmt.Errorf("writing %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// publishSalt writes the salt of the cipher to path, for the other machines
+// with the same passphrase to decrypt the files of this one, or removes it if
+// the cipher has none. It returns whether the file changed.
+func publishSalt(path string, cipher *historyCipher) (bool, error) {
+	old, err := readSalt(path)
+	if err != nil {
+		return false, err
+	}
+	var salt []byte
+	if cipher != nil {
+		salt = cipher.salt
+	}
+	switch {
+	case bytes.Equal(old, salt):
+		return false, nil
+	case salt == nil:
+		if err := os.Remove(path); err != nil {
+			return false, fmt.Errorf("removing salt: %w", err)
+		}
+		return true, nil
+	default:
+		return true, writeSalt(path, salt)
+	}
+}
+
+// storeCipher returns the cipher encrypting the history in the store, if any.
+func storeCipher(store HistoryStore) *historyCipher {
+	if s, ok := store.(*jsonlStore); ok {
+		return s.cipher
+	}
+	return nil
+}
+
+func isGitRepo(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, ".git"))
+	return err == nil
+}
+
+// hasUpstream returns whether the current branch of the repository tracks a
+// remote branch.
+func hasUpstream(dir string) bool {
+	_, err := runGit(dir, "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{upstream}")
+	return err == nil
+}
+
+// commitSync commits the files of the host with the given base path.
+func commitSync(dir, base, host string) error {
+	rel, err := filepath.Rel(dir, base)
+	if err != nil {
+		return err
+	}
+	files := []string{rel + syncHistorySuffix, rel + syncRejectedSuffix}
+	// The salt is only there with a passphrase, but its removal is committed
+	// too.
+	if _, err := os.Stat(base + syncSaltSuffix); err == nil || isTracked(dir, rel+syncSaltSuffix) {
+		files = append(files, rel+syncSaltSuffix)
+	}
+	if _, err := runGit(dir, append([]string{"add", "--"}, files...)...); err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("Sync gencmd history from %s", host)
+	_, err = runGit(dir, append([]string{"commit", "--quiet", "-m", msg, "--"}, files...)...)
+	return err
+}
+
+func isTracked(dir, path string) bool {
+	out, err := runGit(dir, "ls-files", "--", path)
+	return err == nil && out != ""
+}
+
+func runGit(dir string, args ...string) (string, error) {
+	c := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	out, err := c.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("running git %s: %w: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
@@ -0,0 +1,249 @@
+package ctrl
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mbrt/gencmd/config"
+)
+
+func newSyncController(t *testing.T) *Controller {
+	t.Helper()
+	dir := t.TempDir()
+	return &Controller{store: newJSONLStore(
+		filepath.Join(dir, "history.jsonl"),
+		filepath.Join(dir, "rejected.jsonl"),
+	)}
+}
+
+func TestSyncHistory(t *testing.T) {
+	syncDir := filepath.Join(t.TempDir(), "sync")
+	ts := func(min int) time.Time {
+		return time.Date(2025, 1, 1, 0, min, 0, 0, time.UTC)
+	}
+	laptop, server := newSyncController(t), newSyncController(t)
+	require.NoError(t, laptop.store.Replace([]HistoryEntry{
+		{Version: historyVersion, Prompt: "p1", Command: "c1", UseCount: 1, Timestamp: ts(1)},
+		{Version: historyVersion, Prompt: "p2", Command: "c2", UseCount: 2, Timestamp: ts(2)},
+		{Version: historyVersion, Prompt: "p3", Command: "c3", UseCount: 1, Timestamp: ts(3)},
+	}))
+	require.NoError(t, server.store.Replace([]HistoryEntry{
+		{Version: historyVersion, Prompt: "p2", Command: "c2", UseCount: 3, Timestamp: ts(1)},
+		{Version: historyVersion, Prompt: "p4", Command: "c4", UseCount: 1, Timestamp: ts(4)},
+	}))
+	laptopOpts := SyncOptions{Dir: syncDir, Host: "laptop"}
+	serverOpts := SyncOptions{Dir: syncDir, Host: "server"}
+
+	stats, err := laptop.SyncHistory(laptopOpts)
+	require.NoError(t, err)
+	assert.Equal(t, SyncStats{Published: true}, stats)
+	stats, err = server.SyncHistory(serverOpts)
+	require.NoError(t, err)
+	assert.Equal(t, SyncStats{Added: 2, Merged: 1, Published: true}, stats)
+	stats, err = laptop.SyncHistory(laptopOpts)
+	require.NoError(t, err)
+	assert.Equal(t, SyncStats{Added: 1, Merged: 1, Published: true}, stats)
+
+	// The records are merged, so that the uses of both machines add up.
+	want := []HistoryEntry{
+		{Version: historyVersion, Prompt: "p1", Command: "c1", UseCount: 1, Timestamp: ts(1)},
+		{Version: historyVersion, Prompt: "p2", Command: "c2", UseCount: 3, Timestamp: ts(1)},
+		{Version: historyVersion, Prompt: "p2", Command: "c2", UseCount: 2, Timestamp: ts(2)},
+		{Version: historyVersion, Prompt: "p3", Command: "c3", UseCount: 1, Timestamp: ts(3)},
+		{Version: historyVersion, Prompt: "p4", Command: "c4", UseCount: 1, Timestamp: ts(4)},
+	}
+	for _, c := range []*Controller{laptop, server} {
+		entries, _ := c.loadHistoryRaw()
+		assert.Equal(t, want, entries)
+	}
+
+	// Syncing again has no effect.
+	for range 2 {
+		stats, err = server.SyncHistory(serverOpts)
+		require.NoError(t, err)
+		assert.Equal(t, SyncStats{}, stats)
+		stats, err = laptop.SyncHistory(laptopOpts)
+		require.NoError(t, err)
+		assert.Equal(t, SyncStats{}, stats)
+	}
+
+	// Deletions are propagated, instead of entries coming back.
+	require.NoError(t, laptop.DeleteHistory(HistoryEntry{Prompt: "p1", Command: "c1"}))
+	_, err = laptop.SyncHistory(laptopOpts)
+	require.NoError(t, err)
+	stats, err = server.SyncHistory(serverOpts)
+	require.NoError(t, err)
+	assert.Equal(t, SyncStats{Deleted: 1, Published: true}, stats)
+	entries, _ := server.loadHistoryRaw()
+	assert.Equal(t, want[1:], entries)
+	rejected, err := server.store.Rejected()
+	require.NoError(t, err)
+	require.Len(t, rejected, 1)
+	assert.Equal(t, "c1", rejected[0].Command)
+
+	// Unless they are used again after the deletion.
+	require.NoError(t, server.store.Append(HistoryEntry{
+		Version: historyVersion, Prompt: "p1", Command: "c1", UseCount: 1, Timestamp: time.Now().Add(time.Hour),
+	}))
+	_, err = server.SyncHistory(serverOpts)
+	require.NoError(t, err)
+	stats, err = laptop.SyncHistory(laptopOpts)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Added)
+}
+
+func TestSyncHistoryEncrypted(t *testing.T) {
+	syncDir := filepath.Join(t.TempDir(), "sync")
+	newController := func(passphrase string) *Controller {
+		c := newSyncController(t)
+		if passphrase != "" {
+			cipher, err := newHistoryCipher(config.EncryptionConfig{
+				PassphraseCommand: "echo " + passphrase,
+			}, filepath.Join(t.TempDir(), "history.salt"))
+			require.NoError(t, err)
+			c.store.(*jsonlStore).cipher = cipher
+		}
+		return c
+	}
+	laptop, server := newController("secret"), newController("secret")
+	require.NoError(t, laptop.UpdateHistory("p1", "c1", SourceGenerated))
+	require.NoError(t, server.UpdateHistory("p2", "c2", SourceGenerated))
+
+	// Every machine has its own salt, and publishes it for the others with
+	// the same passphrase to decrypt its files.
+	_, err := laptop.SyncHistory(SyncOptions{Dir: syncDir, Host: "laptop"})
+	require.NoError(t, err)
+	stats, err := server.SyncHistory(SyncOptions{Dir: syncDir, Host: "server"})
+	require.NoError(t, err)
+	assert.Equal(t, SyncStats{Added: 1, Published: true}, stats)
+	stats, err = laptop.SyncHistory(SyncOptions{Dir: syncDir, Host: "laptop"})
+	require.NoError(t, err)
+	assert.Equal(t, SyncStats{Added: 1, Published: true}, stats)
+	laptopSalt, err := readSalt(filepath.Join(syncDir, "laptop"+syncSaltSuffix))
+	require.NoError(t, err)
+	serverSalt, err := readSalt(filepath.Join(syncDir, "server"+syncSaltSuffix))
+	require.NoError(t, err)
+	assert.NotEqual(t, laptopSalt, serverSalt)
+	data, err := os.ReadFile(filepath.Join(syncDir, "server"+syncHistorySuffix))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), `"command"`)
+
+	// Files that can't be decrypted are skipped, instead of failing.
+	for host, passphrase := range map[string]string{"desktop": "other", "vm": ""} {
+		c := newController(passphrase)
+		require.NoError(t, c.UpdateHistory("p3", "c3", SourceGenerated))
+		stats, err = c.SyncHistory(SyncOptions{Dir: syncDir, Host: host})
+		require.NoError(t, err, host)
+		assert.Contains(t, stats.Skipped, filepath.Join(syncDir, "laptop"+syncHistorySuffix))
+		assert.Contains(t, stats.Skipped, filepath.Join(syncDir, "server"+syncHistorySuffix))
+		assert.Equal(t, 0, stats.Added)
+	}
+}
+
+func TestSyncHistoryCountsEveryUse(t *testing.T) {
+	syncDir := filepath.Join(t.TempDir(), "sync")
+	laptop, server := newSyncController(t), newSyncController(t)
+	laptopOpts := SyncOptions{Dir: syncDir, Host: "laptop"}
+	serverOpts := SyncOptions{Dir: syncDir, Host: "server"}
+	use := func(c *Controller, host string, min int) {
+		require.NoError(t, c.store.Append(HistoryEntry{
+			Version: historyVersion, Prompt: "p", Command: "c", UseCount: 1, Host: host,
+			Timestamp: time.Date(2025, 1, 1, 0, min, 0, 0, time.UTC),
+		}))
+	}
+	for i := range 3 {
+		use(laptop, "laptop", i)
+	}
+	_, err := laptop.SyncHistory(laptopOpts)
+	require.NoError(t, err)
+	_, err = server.SyncHistory(serverOpts)
+	require.NoError(t, err)
+
+	// Both machines use the command again before syncing.
+	use(laptop, "laptop", 10)
+	use(server, "server", 10)
+	for _, sync := range []struct {
+		c    *Controller
+		opts SyncOptions
+	}{{laptop, laptopOpts}, {server, serverOpts}, {laptop, laptopOpts}} {
+		_, err = sync.c.SyncHistory(sync.opts)
+		require.NoError(t, err)
+	}
+	for _, c := range []*Controller{laptop, server} {
+		history := c.LoadHistory()
+		require.Len(t, history, 1)
+		assert.Equal(t, 5, history[0].UseCount)
+	}
+}
+
+func TestMergeRecordsDeterministic(t *testing.T) {
+	ts := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	record := HistoryEntry{Version: historyVersion, Prompt: "p", Command: "c", Timestamp: ts, UseCount: 1}
+	a, b, c := record, record, record
+	a.Runs, a.LastExitCode = 1, 1
+	b.Runs, b.LastExitCode = 1, 2
+	c.Timestamp = ts.Add(time.Minute)
+	// The same record appears twice in the first history.
+	first := []HistoryEntry{a, record}
+	second := []HistoryEntry{b, c}
+	assert.Equal(t, mergeRecords(first, second), mergeRecords(second, first))
+	assert.Equal(t, []HistoryEntry{
+		{Version: historyVersion, Prompt: "p", Command: "c", Timestamp: ts, UseCount: 1, Runs: 1, LastExitCode: 2},
+		record,
+		c,
+	}, mergeRecords(first, second))
+}
+
+func TestSyncHistoryGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+	tmp := t.TempDir()
+	remote := filepath.Join(tmp, "remote.git")
+	clone1, clone2 := filepath.Join(tmp, "clone1"), filepath.Join(tmp, "clone2")
+	git := func(args ...string) string {
+		out, err := exec.Command("git", args...).CombinedOutput()
+		require.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "--quiet", "--bare", "--initial-branch=main", remote)
+	git("clone", "--quiet", remote, clone1)
+	git("-C", clone1, "commit", "--quiet", "--allow-empty", "-m", "init")
+	git("-C", clone1, "push", "--quiet", "-u", "origin", "HEAD")
+	git("clone", "--quiet", remote, clone2)
+
+	laptop, server := newSyncController(t), newSyncController(t)
+	require.NoError(t, laptop.UpdateHistory("p1", "c1", SourceGenerated))
+	require.NoError(t, server.UpdateHistory("p2", "c2", SourceGenerated))
+
+	_, err := laptop.SyncHistory(SyncOptions{Dir: clone1, Host: "laptop"})
+	require.NoError(t, err)
+	stats, err := server.SyncHistory(SyncOptions{Dir: clone2, Host: "server"})
+	require.NoError(t, err)
+	assert.Equal(t, SyncStats{Added: 1, Published: true}, stats)
+	assert.Equal(t, "3", git("-C", remote, "rev-list", "--count", "HEAD"))
+
+	// Syncing again doesn't commit.
+	stats, err = server.SyncHistory(SyncOptions{Dir: clone2, Host: "server"})
+	require.NoError(t, err)
+	assert.Equal(t, SyncStats{}, stats)
+	assert.Equal(t, "3", git("-C", remote, "rev-list", "--count", "HEAD"))
+	assert.Empty(t, git("-C", clone2, "status", "--porcelain"))
+
+	stats, err = laptop.SyncHistory(SyncOptions{Dir: clone1, Host: "laptop"})
+	require.NoError(t, err)
+	assert.Equal(t, SyncStats{Added: 1, Published: true}, stats)
+	_, err = os.Stat(filepath.Join(clone1, "server"+syncHistorySuffix))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,183 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/cursor"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textarea"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Commands longer than this are edited in $EDITOR, when set.
+const (
+	maxInlineEditLen   = 200
+	maxInlineEditLines = 5
+)
+
+func newEditModel(km KeyMap, command string) editModel {
+	ta := textarea.New()
+	ta.ShowLineNumbers = false
+	ta.Prompt = "  "
+	ta.CharLimit = 0
+	ta.KeyMap.InsertNewline = key.NewBinding(
+		key.WithKeys("alt+enter"),
+		key.WithHelp("alt+enter", "new line"),
+	)
+	// A static cursor doesn't need blink messages.
+	ta.Cursor.SetMode(cursor.CursorStatic)
+	ta.SetHeight(min(max(strings.Count(command, "\n")+1, 3), maxInlineEditLines+1))
+	ta.SetValue(command)
+	ta.Focus()
+
+	return editModel{
+		keyMap:   km,
+		textarea: ta,
+	}
+}
+
+// editModel edits a command inline, in a multi-line text area.
+type editModel struct {
+	keyMap   KeyMap
+	textarea textarea.Model
+}
+
+func (m editModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m editModel) Update(msg tea.Msg) (editModel, tea.Cmd) {
+	if msg, ok := msg.(tea.WindowSizeMsg); ok {
+		m.textarea.SetWidth(max(msg.Width-4, 10))
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.textarea, cmd = m.textarea.Update(msg)
+	return m, cmd
+}
+
+func (m editModel) View() string {
+	var b strings.Builder
+	b.WriteString(msgStyle.Render("Edit command"))
+	b.WriteString("\n")
+	b.WriteString(m.textarea.View())
+	b.WriteString("\n")
+	return b.String()
+}
+
+func (m editModel) ShortHelp() []key.Binding {
+	return []key.Binding{
+		m.keyMap.Submit,
+		m.textarea.KeyMap.InsertNewline,
+		key.NewBinding(key.WithKeys("esc"), key.WithHelp("esc", "back")),
+	}
+}
+
+func (m editModel) FullHelp() [][]key.Binding {
+	return [][]key.Binding{m.ShortHelp()}
+}
+
+// Value returns the edited command.
+func (m editModel) Value() string {
+	return strings.TrimSpace(m.textarea.Value())
+}
+
+// useExternalEditor returns whether the command is long enough to be edited
+// in the user's editor, instead of inline.
+func useExternalEditor(command string) bool {
+	if userEditor() == "" {
+		return false
+	}
+	return len(command) > maxInlineEditLen || strings.Count(command, "\n") >= maxInlineEditLines
+}
+
+// editedMsg is sent when the external editor exits.
+type editedMsg struct {
+	Command string
+	Err     error
+}
+
+// runExternalEditor opens the command in the user's editor, suspending the UI
+// until the editor exits.
+func runExternalEditor(command string) tea.Cmd {
+	path, err := writeEditFile(command)
+	if err != nil {
+		return func() tea.Msg { return editedMsg{Err: err} }
+	}
+	return tea.ExecProcess(editorCommand(userEditor(), path), func(err error) tea.Msg {
+		if err != nil {
+			os.Remove(path)
+			return editedMsg{Err: fmt.Errorf("running editor: %w", err)}
+		}
+		edited, err := readEditFile(path)
+		return editedMsg{Command: edited, Err: err}
+	})
+}
+
+// EditText opens the text in the user's editor, or vi when none is set, and
+// returns the edited text.
+func EditText(text string) (string, error) {
+	editor := userEditor()
+	if editor == "" {
+		editor = "vi"
+	}
+	path, err := writeEditFile(text)
+	if err != nil {
+		return "", err
+	}
+	c := editorCommand(editor, path)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := c.Run(); err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("running editor: %w", err)
+	}
+	return readEditFile(path)
+}
+
+// userEditor returns the editor set by the user in $VISUAL or $EDITOR, if
+// any.
+func userEditor() string {
+	if editor := os.Getenv("VISUAL"); editor != "" {
+		return editor
+	}
+	return os.Getenv("EDITOR")
+}
+
+// editorCommand returns the command opening the file at path in the editor,
+// which may contain arguments (e.g. "code --wait").
+func editorCommand(editor, path string) *exec.Cmd {
+	return exec.Command("sh", "-c", editor+` "$1"`, "sh", path)
+}
+
+// writeEditFile writes the text to a temporary file to edit, and returns its
+// path.
+func writeEditFile(text string) (string, error) {
+	f, err := os.CreateTemp("", "gencmd-*.sh")
+	if err != nil {
+		return "", fmt.Errorf("creating temporary file: %w", err)
+	}
+	path := f.Name()
+	_, err = f.WriteString(text + "\n")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("writing temporary file: %w", err)
+	}
+	return path, nil
+}
+
+// readEditFile returns the edited text in the temporary file, without the
+// surrounding whitespace editors usually add, and removes the file.
+func readEditFile(path string) (string, error) {
+	defer os.Remove(path)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading edited text: %w", err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
@@ -76,10 +76,11 @@ func (f *FakeController) LoadHistory() []ctrl.HistoryEntry {
 	return f.history
 }
 
-func (f *FakeController) UpdateHistory(prompt, command string) error {
+func (f *FakeController) UpdateHistory(prompt, command, source string) error {
 	f.history = append(f.history, ctrl.HistoryEntry{
 		Prompt:  prompt,
 		Command: command,
+		Source:  source,
 	})
 	return nil
 }
@@ -96,6 +97,17 @@ func (f *FakeController) DeleteHistory(entry ctrl.HistoryEntry) error {
 	return nil
 }
 
+func (f *FakeController) ReplaceHistory(old, updated ctrl.HistoryEntry) error {
+	var res []ctrl.HistoryEntry
+	for _, entry := range f.history {
+		if entry != old {
+			res = append(res, entry)
+		}
+	}
+	f.history = append(res, updated)
+	return nil
+}
+
 func (f *FakeController) GenerateCommands(string) ([]string, error) {
 	time.Sleep(f.generateDelay) // Simulate a delay
 	return f.commands, f.generateErr
@@ -0,0 +1,158 @@
+package ui
+
+import (
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/cursor"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/mbrt/gencmd/ctrl"
+)
+
+var (
+	commandStyle   = lipgloss.NewStyle().PaddingLeft(4).Foreground(lipgloss.Color("170"))
+	fieldStyle     = lipgloss.NewStyle().PaddingLeft(4)
+	fieldNameStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("240"))
+)
+
+// newFormModel creates a form to fill in the placeholders of the command.
+func newFormModel(km KeyMap, command string, placeholders []ctrl.Placeholder) formModel {
+	dir, _ := os.Getwd()
+	inputs := make([]textinput.Model, len(placeholders))
+	for i, p := range placeholders {
+		ti := textinput.New()
+		ti.Prompt = ""
+		ti.Placeholder = p.Name
+		ti.CharLimit = 256
+		ti.Width = 60
+		// A static cursor is enough to show the focused field.
+		ti.Cursor.SetMode(cursor.CursorStatic)
+		// Up and down move between fields.
+		ti.KeyMap.NextSuggestion.SetEnabled(false)
+		ti.KeyMap.PrevSuggestion.SetEnabled(false)
+
+		value, suggestions := suggestPlaceholder(p, dir)
+		ti.SetValue(value)
+		if len(suggestions) > 0 {
+			ti.ShowSuggestions = true
+			ti.SetSuggestions(suggestions)
+		}
+		inputs[i] = ti
+	}
+	if len(inputs) > 0 {
+		inputs[0].Focus()
+	}
+
+	return formModel{
+		keyMap:       km,
+		command:      command,
+		placeholders: placeholders,
+		inputs:       inputs,
+	}
+}
+
+// formModel asks for a value for each placeholder of a command.
+type formModel struct {
+	keyMap       KeyMap
+	command      string
+	placeholders []ctrl.Placeholder
+	inputs       []textinput.Model
+	focus        int
+}
+
+func (m formModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m formModel) Update(msg tea.Msg) (formModel, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		for i := range m.inputs {
+			m.inputs[i].Width = max(msg.Width-30, 10)
+		}
+		return m, nil
+
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, m.keyMap.Up):
+			return m, m.setFocus(m.focus - 1)
+		case key.Matches(msg, m.keyMap.Down):
+			return m, m.setFocus(m.focus + 1)
+		}
+	}
+
+	if len(m.inputs) == 0 {
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.inputs[m.focus], cmd = m.inputs[m.focus].Update(msg)
+	return m, cmd
+}
+
+func (m formModel) View() string {
+	var b strings.Builder
+	b.WriteString(msgStyle.Render("Fill in the placeholders"))
+	b.WriteString("\n")
+	b.WriteString(commandStyle.Render(m.Command()))
+	b.WriteString("\n\n")
+
+	width := 0
+	for _, p := range m.placeholders {
+		width = max(width, len(p.Name))
+	}
+	for i, p := range m.placeholders {
+		cursor := "  "
+		if i == m.focus {
+			cursor = "> "
+		}
+		name := fieldNameStyle.Render(p.Name + ":" + strings.Repeat(" ", width-len(p.Name)))
+		b.WriteString(fieldStyle.Render(cursor + name + " " + m.inputs[i].View()))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func (m formModel) ShortHelp() []key.Binding {
+	return []key.Binding{
+		m.keyMap.Submit,
+		m.keyMap.Cancel,
+		m.keyMap.Up,
+		m.keyMap.Down,
+	}
+}
+
+func (m formModel) FullHelp() [][]key.Binding {
+	return [][]key.Binding{m.ShortHelp()}
+}
+
+// Next moves the focus to the next field. It returns false if the focus was
+// already on the last field.
+func (m *formModel) Next() (bool, tea.Cmd) {
+	if m.focus >= len(m.inputs)-1 {
+		return false, nil
+	}
+	return true, m.setFocus(m.focus + 1)
+}
+
+// Command returns the command with the placeholders replaced by the values
+// filled in so far.
+func (m formModel) Command() string {
+	values := make(map[string]string, len(m.placeholders))
+	for i, p := range m.placeholders {
+		values[p.Text] = strings.TrimSpace(m.inputs[i].Value())
+	}
+	return ctrl.FillPlaceholders(m.command, values)
+}
+
+func (m *formModel) setFocus(i int) tea.Cmd {
+	if i < 0 || i >= len(m.inputs) {
+		return nil
+	}
+	m.inputs[m.focus].Blur()
+	m.focus = i
+	return m.inputs[m.focus].Focus()
+}
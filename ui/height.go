@@ -0,0 +1,45 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// minInlineHeight is the minimum number of lines the inline UI can use.
+const minInlineHeight = 8
+
+// Height is the height of the UI when rendered inline, either as a number of
+// lines or as a percentage of the terminal height.
+type Height struct {
+	Value   int
+	Percent bool
+}
+
+// ParseHeight parses a height like "20" (lines) or "40%".
+func ParseHeight(s string) (Height, error) {
+	s = strings.TrimSpace(s)
+	percent := strings.HasSuffix(s, "%")
+	v, err := strconv.Atoi(strings.TrimSuffix(s, "%"))
+	if err != nil || v <= 0 || (percent && v > 100) {
+		return Height{}, fmt.Errorf("invalid height %q: use a number of lines or a percentage (e.g. 40%%)", s)
+	}
+	return Height{Value: v, Percent: percent}, nil
+}
+
+// IsZero returns whether the height is unset, i.e. the UI is full screen.
+func (h Height) IsZero() bool {
+	return h.Value == 0
+}
+
+// Lines returns the number of lines to use, given the terminal height.
+func (h Height) Lines(total int) int {
+	if h.IsZero() {
+		return total
+	}
+	lines := h.Value
+	if h.Percent {
+		lines = total * h.Value / 100
+	}
+	return min(max(lines, minInlineHeight), total)
+}
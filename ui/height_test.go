@@ -0,0 +1,58 @@
+package ui
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHeight(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Height
+		wantErr bool
+	}{
+		{in: "20", want: Height{Value: 20}},
+		{in: "40%", want: Height{Value: 40, Percent: true}},
+		{in: "0", wantErr: true},
+		{in: "120%", wantErr: true},
+		{in: "abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseHeight(tt.in)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHeightLines(t *testing.T) {
+	assert.Equal(t, 50, Height{}.Lines(50))
+	assert.Equal(t, 20, Height{Value: 40, Percent: true}.Lines(50))
+	assert.Equal(t, 12, Height{Value: 12}.Lines(50))
+	// Never below the minimum, nor above the terminal height.
+	assert.Equal(t, minInlineHeight, Height{Value: 2}.Lines(50))
+	assert.Equal(t, 30, Height{Value: 40}.Lines(30))
+}
+
+func TestInlineView(t *testing.T) {
+	model := New(NewFakeController())
+	model.maxHeight = Height{Value: 40, Percent: true}
+	model = updateModel(model, tea.WindowSizeMsg{Width: 80, Height: 50})
+
+	assert.Equal(t, 20, model.height)
+	assert.LessOrEqual(t, lipgloss.Height(model.View()), 20)
+
+	// The UI is cleared on exit.
+	model = updateModel(model, tea.KeyMsg{Type: tea.KeyEnter})
+	assert.Equal(t, stateSelected, model.state)
+	assert.Empty(t, model.View())
+}
@@ -46,6 +46,12 @@ func selectProvider(providers []config.ProviderDoc) (config.ProviderDoc, error)
 func askOptions(provider config.ProviderDoc) (map[string]string, error) {
 	res := make(map[string]string)
 	for _, opt := range provider.Options {
+		if opt.Secret {
+			var err error
+			if opt, err = askSecretSource(opt); err != nil {
+				return nil, err
+			}
+		}
 		m, err := tea.NewProgram(newAskOptionModel(opt)).Run()
 		if err != nil {
 			return nil, err
@@ -59,6 +65,38 @@ func askOptions(provider config.ProviderDoc) (map[string]string, error) {
 	return res, nil
 }
 
+// askSecretSource lets the user choose between pasting a secret and providing
+// a command that prints it. The returned option asks for the chosen one.
+func askSecretSource(opt config.ProviderOption) (config.ProviderOption, error) {
+	choices := []choiceItem{
+		{
+			title: "Paste " + opt.Name,
+			desc:  "Stored in plain text in the .env file",
+		},
+		{
+			title: "Use a command printing " + opt.Name,
+			desc:  "e.g. pass show gemini, or op read op://vault/gemini/key",
+		},
+	}
+	m, err := tea.NewProgram(newChoiceModel("How do you want to provide "+opt.Name+"?", choices)).Run()
+	if err != nil {
+		return opt, err
+	}
+	res := m.(choiceModel)
+	switch res.selected {
+	case 0:
+		return opt, nil
+	case 1:
+		return config.ProviderOption{
+			Name:        opt.Name + " command",
+			EnvVar:      opt.CommandEnvVar(),
+			Description: "Command printing the secret, e.g. pass show gemini",
+		}, nil
+	default:
+		return opt, fmt.Errorf("no value provided for %q", opt.Name)
+	}
+}
+
 func newSelectProviderModel(providers []config.ProviderDoc) selectProviderModel {
 	items := make([]list.Item, len(providers))
 	for i, p := range providers {
@@ -162,3 +200,60 @@ func (m askOptionModel) View() string {
 		m.textInput.View(),
 	)
 }
+
+func newChoiceModel(title string, choices []choiceItem) choiceModel {
+	items := make([]list.Item, len(choices))
+	for i, c := range choices {
+		items[i] = c
+	}
+	l := list.New(items, list.NewDefaultDelegate(), 80, 10)
+	l.Title = title
+	l.SetShowStatusBar(false)
+	l.SetShowHelp(false)
+	l.SetFilteringEnabled(false)
+
+	return choiceModel{
+		list:     l,
+		selected: -1,
+	}
+}
+
+// choiceModel lets the user pick one of a few fixed choices.
+type choiceModel struct {
+	list     list.Model
+	selected int
+}
+
+func (m choiceModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m choiceModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.Type {
+		case tea.KeyEscape, tea.KeyCtrlC:
+			return m, tea.Quit
+		case tea.KeyEnter:
+			m.selected = m.list.Index()
+			return m, tea.Quit
+		}
+	}
+
+	var cmd tea.Cmd
+	m.list, cmd = m.list.Update(msg)
+	return m, cmd
+}
+
+func (m choiceModel) View() string {
+	return "\n" + m.list.View()
+}
+
+type choiceItem struct {
+	title string
+	desc  string
+}
+
+func (i choiceItem) FilterValue() string { return i.title }
+func (i choiceItem) Title() string       { return i.title }
+func (i choiceItem) Description() string { return i.desc }
@@ -11,6 +11,7 @@ type KeyMap struct {
 	Down          key.Binding
 	ToggleHistory key.Binding
 	DeleteHistory key.Binding
+	Edit          key.Binding
 	ToggleHelp    key.Binding
 }
 
@@ -40,6 +41,10 @@ func DefaultKeyMap() KeyMap {
 			key.WithKeys("ctrl+d"),
 			key.WithHelp("ctrl+d", "delete item"),
 		),
+		Edit: key.NewBinding(
+			key.WithKeys("ctrl+e"),
+			key.WithHelp("ctrl+e", "edit command"),
+		),
 		ToggleHelp: key.NewBinding(
 			key.WithKeys("ctrl+h"),
 			key.WithHelp("ctrl+h", "help"),
@@ -18,10 +18,11 @@ import (
 var ErrUserCancel = errors.New("user cancelled")
 
 var (
-	titleStyle  = lipgloss.NewStyle().Background(lipgloss.Color("62")).Foreground(lipgloss.Color("230")).Padding(0, 1)
-	itemStyle   = lipgloss.NewStyle().PaddingLeft(4)
-	helpStyle   = lipgloss.NewStyle().PaddingTop(1).PaddingLeft(2)
-	promptStyle = lipgloss.NewStyle().PaddingTop(1)
+	titleStyle     = lipgloss.NewStyle().Background(lipgloss.Color("62")).Foreground(lipgloss.Color("230")).Padding(0, 1)
+	itemStyle      = lipgloss.NewStyle().PaddingLeft(4)
+	helpStyle      = lipgloss.NewStyle().PaddingTop(1).PaddingLeft(2)
+	promptStyle    = lipgloss.NewStyle().PaddingTop(1)
+	incognitoStyle = lipgloss.NewStyle().Background(lipgloss.Color("236")).Foreground(lipgloss.Color("250")).Padding(0, 1)
 )
 
 type state int
@@ -30,13 +31,44 @@ const (
 	statePrompting state = iota
 	stateGenerating
 	stateSelecting
+	stateFilling
+	stateEditing
 	stateSelected
 )
 
 // RunUI starts the gencmd UI with the provided controller and options.
 func RunUI(c Controller, opts Options) error {
-	teaOpts := []tea.ProgramOption{
-		tea.WithAltScreen(),
+	if opts.Tmux != nil {
+		pane := os.Getenv(tmuxPaneEnv)
+		if pane == "" {
+			return runTmuxPopup(*opts.Tmux)
+		}
+		// We are already inside the popup.
+		opts.TmuxPane = pane
+	}
+	if !terminalAvailable(opts.TtyPath) {
+		if opts.Incognito {
+			fmt.Fprintln(os.Stderr, "Incognito: the selected command is not saved in history.")
+		}
+		selected, err := runPlain(c, os.Stdin, os.Stderr)
+		if err != nil {
+			return err
+		}
+		return output(opts, selected)
+	}
+
+	var (
+		height  Height
+		teaOpts []tea.ProgramOption
+	)
+	if opts.Height != "" {
+		h, err := ParseHeight(opts.Height)
+		if err != nil {
+			return err
+		}
+		height = h
+	} else {
+		teaOpts = append(teaOpts, tea.WithAltScreen())
 	}
 
 	if opts.TtyPath != "" {
@@ -51,30 +83,48 @@ func RunUI(c Controller, opts Options) error {
 		teaOpts = append(teaOpts, tea.WithInput(tty), tea.WithOutput(tty))
 	}
 
-	p := tea.NewProgram(New(c), teaOpts...)
+	m := New(c)
+	m.maxHeight = height
+	m.incognito = opts.Incognito
+	p := tea.NewProgram(m, teaOpts...)
 
-	m, err := p.Run()
+	res, err := p.Run()
 	if err != nil {
 		return fmt.Errorf("running UI: %w", err)
 	}
-	finalModel := m.(Model)
+	finalModel := res.(Model)
 	if finalModel.err != nil {
 		return finalModel.err
 	}
-	if finalModel.selected != "" {
-		fmt.Println(finalModel.selected)
+	if finalModel.selected == "" {
+		return nil
 	}
-	return nil
+	return output(opts, finalModel.selected)
 }
 
 type Options struct {
 	TtyPath string
+	// Height renders the UI inline below the prompt, in the given number of
+	// lines or percentage of the terminal (e.g. 40%), instead of full screen.
+	Height string
+	// Tmux runs the UI in a tmux popup, when set.
+	Tmux *TmuxOptions
+	// TmuxPane is the tmux pane to type the selection into. When empty, the
+	// selection is printed to stdout.
+	TmuxPane string
+	// OutputTo lists the targets for the selection (see OutputTargets).
+	// Defaults to stdout.
+	OutputTo []string
+	// Incognito shows that the selection is not saved in history. Saving is
+	// up to the controller.
+	Incognito bool
 }
 
 type Controller interface {
 	LoadHistory() []ctrl.HistoryEntry
-	UpdateHistory(prompt, command string) error
+	UpdateHistory(prompt, command, source string) error
 	DeleteHistory(entry ctrl.HistoryEntry) error
+	ReplaceHistory(old, updated ctrl.HistoryEntry) error
 	GenerateCommands(prompt string) ([]string, error)
 }
 
@@ -85,6 +135,8 @@ type Model struct {
 	prompt     promptModel
 	wait       waitModel
 	selectCmp  selectModel
+	form       formModel
+	edit       editModel
 	help       help.Model
 	state      state
 	promptText string
@@ -92,6 +144,19 @@ type Model struct {
 	err        error
 	width      int
 	height     int
+	// maxHeight limits the lines used when rendering inline.
+	maxHeight Height
+	// template is the selected command, before filling in its placeholders.
+	template string
+	// source tells how the selected command was obtained (e.g.
+	// ctrl.SourceGenerated).
+	source string
+	// editFrom is the state to go back to when editing is cancelled.
+	editFrom state
+	// replacing is the history entry being edited, if any.
+	replacing *ctrl.HistoryEntry
+	// incognito shows the incognito indicator in the title bar.
+	incognito bool
 }
 
 func New(c Controller) Model {
@@ -122,22 +187,29 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.WindowSizeMsg:
 		// Store the original window size for potential resize events
 		m.width = msg.Width
-		m.height = msg.Height
+		m.height = m.maxHeight.Lines(msg.Height)
 		// Calculate available height for content
-		availableHeight := m.calculateAvailableHeight(msg.Height)
+		availableHeight := m.calculateAvailableHeight(m.height)
 		resizedMsg := tea.WindowSizeMsg{Width: msg.Width, Height: availableHeight}
 		// Forward adjusted window size message to models
 		cmds = append(cmds, m.updateModels(resizedMsg, false))
 
 	case tea.KeyMsg:
-		cmds = append(cmds,
-			m.handleKey(msg),
-			m.updateModels(msg, false),
-		)
+		// The edit key is also the end of line of the text inputs, so it
+		// doesn't reach them where it starts editing.
+		startsEdit := key.Matches(msg, m.KeyMap.Edit) &&
+			(m.state == statePrompting || m.state == stateSelecting)
+		cmds = append(cmds, m.handleKey(msg))
+		if !startsEdit {
+			cmds = append(cmds, m.updateModels(msg, false))
+		}
 
 	case generateMsg:
 		cmds = append(cmds, m.handleCompletion(msg.Prompt, msg.Commands))
 
+	case editedMsg:
+		cmds = append(cmds, m.handleEdited(msg))
+
 	case errMsg:
 		cmds = append(cmds, m.quitWithError(msg))
 
@@ -149,12 +221,19 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 }
 
 func (m Model) View() string {
+	if m.state == stateSelected && !m.maxHeight.IsZero() {
+		// Clear the inline UI on exit, like fzf does.
+		return ""
+	}
 	if m.err != nil {
 		return fmt.Sprintf("\nError: %v\n\n", m.err)
 	}
 
 	var b strings.Builder
 	b.WriteString(titleStyle.Render("gencmd"))
+	if m.incognito {
+		b.WriteString(incognitoStyle.Render("incognito"))
+	}
 	b.WriteString("\n")
 
 	switch m.state {
@@ -164,6 +243,10 @@ func (m Model) View() string {
 		b.WriteString(m.wait.View())
 	case stateSelecting:
 		b.WriteString(m.selectCmp.View())
+	case stateFilling:
+		b.WriteString(m.form.View())
+	case stateEditing:
+		b.WriteString(m.edit.View())
 	}
 
 	// Show help text
@@ -180,6 +263,10 @@ func (m Model) ShortHelp() []key.Binding {
 		return m.wait.ShortHelp()
 	case stateSelecting:
 		return m.selectCmp.ShortHelp()
+	case stateFilling:
+		return m.form.ShortHelp()
+	case stateEditing:
+		return m.edit.ShortHelp()
 	default:
 		return []key.Binding{m.KeyMap.Cancel}
 	}
@@ -193,6 +280,10 @@ func (m Model) FullHelp() [][]key.Binding {
 		return m.wait.FullHelp()
 	case stateSelecting:
 		return m.selectCmp.FullHelp()
+	case stateFilling:
+		return m.form.FullHelp()
+	case stateEditing:
+		return m.edit.FullHelp()
 	default:
 		return [][]key.Binding{{m.KeyMap.Cancel}}
 	}
@@ -216,6 +307,15 @@ func (m *Model) updateModels(msg tea.Msg, onlyActive bool) tea.Cmd {
 		m.selectCmp, cmd = m.selectCmp.Update(msg)
 		cmds = append(cmds, cmd)
 	}
+	// The form and the editor only exist while in use.
+	if m.state == stateFilling {
+		m.form, cmd = m.form.Update(msg)
+		cmds = append(cmds, cmd)
+	}
+	if m.state == stateEditing {
+		m.edit, cmd = m.edit.Update(msg)
+		cmds = append(cmds, cmd)
+	}
 
 	return tea.Batch(cmds...)
 }
@@ -223,8 +323,27 @@ func (m *Model) updateModels(msg tea.Msg, onlyActive bool) tea.Cmd {
 func (m *Model) handleKey(msg tea.KeyMsg) tea.Cmd {
 	switch {
 	case key.Matches(msg, m.KeyMap.Cancel):
+		if m.state == stateEditing {
+			// Go back to the list, discarding the changes.
+			m.state = m.editFrom
+			m.replacing = nil
+			return nil
+		}
 		return m.quitWithError(ErrUserCancel)
 
+	case key.Matches(msg, m.KeyMap.Edit):
+		switch m.state {
+		case statePrompting:
+			selected := m.prompt.Selected()
+			if selected.IsNew() || selected.Empty() {
+				return nil
+			}
+			entry := ctrl.HistoryEntry{Prompt: selected.Prompt, Command: selected.Command}
+			return m.startEdit(selected.Prompt, selected.Command, &entry)
+		case stateSelecting:
+			return m.startEdit(m.promptText, m.selectCmp.Selected(), nil)
+		}
+
 	case key.Matches(msg, m.KeyMap.Submit):
 		switch m.state {
 
@@ -235,27 +354,45 @@ func (m *Model) handleKey(msg tea.KeyMsg) tea.Cmd {
 				return m.runGenerate(selected.Prompt)
 			}
 			// User selected an existing command
-			return m.selectCommand(selected.Prompt, selected.Command)
+			return m.selectCommand(selected.Prompt, selected.Command, ctrl.SourceHistory)
 
 		case stateSelecting:
 			// User selected a command from the list
 			selected := m.selectCmp.Selected()
-			return m.selectCommand(m.promptText, selected)
+			return m.selectCommand(m.promptText, selected, ctrl.SourceGenerated)
+
+		case stateFilling:
+			if ok, cmd := m.form.Next(); ok {
+				return cmd
+			}
+			return m.finishForm()
+
+		case stateEditing:
+			if edited := m.edit.Value(); edited != "" {
+				return m.selectCommand(m.promptText, edited, ctrl.SourceEdited)
+			}
 		}
 
 	case key.Matches(msg, m.KeyMap.ToggleHelp):
 		m.help.ShowAll = !m.help.ShowAll
 		// Trigger a resize event to update list heights based on new help size
-		if m.width > 0 {
-			availableHeight := m.calculateAvailableHeight(m.height)
-			resizedMsg := tea.WindowSizeMsg{Width: m.width, Height: availableHeight}
-			return m.updateModels(resizedMsg, true)
-		}
+		return m.resizeActive()
 	}
 
 	return nil
 }
 
+// resizeActive sends the current size to the active model, e.g. after it
+// has been created or the help changed size.
+func (m *Model) resizeActive() tea.Cmd {
+	if m.width == 0 {
+		return nil
+	}
+	availableHeight := m.calculateAvailableHeight(m.height)
+	resizedMsg := tea.WindowSizeMsg{Width: m.width, Height: availableHeight}
+	return m.updateModels(resizedMsg, true)
+}
+
 func (m *Model) runGenerate(prompt string) tea.Cmd {
 	m.promptText = prompt
 	m.state = stateGenerating
@@ -281,15 +418,68 @@ func (m *Model) handleCompletion(prompt string, commands []string) tea.Cmd {
 	}
 
 	// If there's only one command, select it directly
-	return m.selectCommand(prompt, commands[0])
+	return m.selectCommand(prompt, commands[0], ctrl.SourceGenerated)
 }
 
-func (m *Model) selectCommand(prompt string, command string) tea.Cmd {
+func (m *Model) selectCommand(prompt, command, source string) tea.Cmd {
 	if command == "" {
 		return m.quitWithError(fmt.Errorf("no command selected"))
 	}
+	m.promptText = prompt
+	m.template = command
+	m.source = source
+	if placeholders := ctrl.FindPlaceholders(command); len(placeholders) > 0 {
+		m.form = newFormModel(m.KeyMap, command, placeholders)
+		m.state = stateFilling
+		return tea.Batch(m.form.Init(), m.resizeActive())
+	}
+	return m.finishSelection(command)
+}
+
+// startEdit opens the command in the inline editor or, for long commands, in
+// $EDITOR. When editing a history entry, it is replaced by the result.
+func (m *Model) startEdit(prompt, command string, replacing *ctrl.HistoryEntry) tea.Cmd {
+	if command == "" {
+		return nil
+	}
+	m.promptText = prompt
+	m.replacing = replacing
+	m.editFrom = m.state
+	if useExternalEditor(command) {
+		return runExternalEditor(command)
+	}
+	m.edit = newEditModel(m.KeyMap, command)
+	m.state = stateEditing
+	return m.resizeActive()
+}
+
+func (m *Model) handleEdited(msg editedMsg) tea.Cmd {
+	if msg.Err != nil {
+		return m.quitWithError(msg.Err)
+	}
+	if msg.Command == "" {
+		// Nothing to select, stay where we were.
+		m.replacing = nil
+		return nil
+	}
+	return m.selectCommand(m.promptText, msg.Command, ctrl.SourceEdited)
+}
+
+func (m *Model) finishForm() tea.Cmd {
+	return m.finishSelection(m.form.Command())
+}
+
+// finishSelection outputs the command. History keeps the command with its
+// placeholders, so that they can be filled in again next time.
+func (m *Model) finishSelection(command string) tea.Cmd {
 	m.selected = command
-	m.controller.UpdateHistory(prompt, command)
+	entry := ctrl.HistoryEntry{Prompt: m.promptText, Command: m.template}
+	if m.replacing != nil {
+		// Keep the edited version instead of the original.
+		m.controller.ReplaceHistory(*m.replacing, entry)
+	} else {
+		m.controller.UpdateHistory(entry.Prompt, entry.Command, m.source)
+	}
 	m.state = stateSelected
 	return tea.Quit
 }
@@ -2,6 +2,7 @@ package ui
 
 import (
 	"errors"
+	"strings"
 	"testing"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -63,6 +64,37 @@ func TestCompleteUIWorkflow(t *testing.T) {
 				finalState:      stateSelected,
 			},
 		},
+		{
+			name:     "fill in placeholders",
+			commands: []string{"cp <source> <destination>"},
+			userActions: []userAction{
+				{action: typeText, value: "copy a file"},
+				{action: pressKey, key: tea.KeyEnter},
+				{action: typeText, value: "a.txt"},
+				{action: pressKey, key: tea.KeyEnter},
+				{action: typeText, value: "b.txt"},
+				{action: pressKey, key: tea.KeyEnter},
+			},
+			expectedResult: workflowResult{
+				selectedCommand: "cp a.txt b.txt",
+				finalState:      stateSelected,
+			},
+		},
+		{
+			name:     "placeholders left empty",
+			commands: []string{"cp <source> <destination>"},
+			userActions: []userAction{
+				{action: typeText, value: "copy a file"},
+				{action: pressKey, key: tea.KeyEnter},
+				{action: pressKey, key: tea.KeyDown},
+				{action: typeText, value: "b.txt"},
+				{action: pressKey, key: tea.KeyEnter},
+			},
+			expectedResult: workflowResult{
+				selectedCommand: "cp <source> b.txt",
+				finalState:      stateSelected,
+			},
+		},
 		{
 			name: "user cancellation",
 			userActions: []userAction{
@@ -239,6 +271,13 @@ func TestUIViewRendering(t *testing.T) {
 	}
 }
 
+func TestIncognitoIndicator(t *testing.T) {
+	model := New(NewFakeController())
+	assert.NotContains(t, model.View(), "incognito")
+	model.incognito = true
+	assert.Contains(t, strings.SplitN(model.View(), "\n", 2)[0], "incognito")
+}
+
 // TestDeleteHistoryUI tests the UI functionality for deleting history entries
 func TestDeleteHistoryUI(t *testing.T) {
 	t.Run("delete selected history entry", func(t *testing.T) {
@@ -349,3 +388,77 @@ func updateModel(m Model, msg tea.Msg) Model {
 	}
 	return updateModel(m, cmd())
 }
+
+// TestEditCommand tests editing commands before accepting them
+func TestEditCommand(t *testing.T) {
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "")
+
+	t.Run("edit generated command", func(t *testing.T) {
+		controller := &FakeController{commands: []string{"ls -l", "ls -la"}}
+		model := New(controller)
+
+		model = typeTextIntoModel(model, "list files")
+		model = updateModel(model, tea.KeyMsg{Type: tea.KeyEnter})
+		model = updateModel(model, tea.KeyMsg{Type: tea.KeyCtrlE})
+		assert.Equal(t, stateEditing, model.state)
+		model = typeTextIntoModel(model, "h")
+		model = updateModel(model, tea.KeyMsg{Type: tea.KeyEnter})
+
+		assert.Equal(t, stateSelected, model.state)
+		assert.Equal(t, "ls -lh", model.selected)
+		assert.Equal(t, []ctrl.HistoryEntry{
+			{Prompt: "list files", Command: "ls -lh", Source: ctrl.SourceEdited},
+		}, controller.LoadHistory())
+	})
+
+	t.Run("edit history entry", func(t *testing.T) {
+		controller := &FakeController{
+			history: []ctrl.HistoryEntry{
+				{Prompt: "p1", Command: "c1"},
+				{Prompt: "p2", Command: "c2"},
+			},
+		}
+		model := New(controller)
+
+		model = updateModel(model, tea.KeyMsg{Type: tea.KeyCtrlE})
+		model = typeTextIntoModel(model, " --edited")
+		model = updateModel(model, tea.KeyMsg{Type: tea.KeyEnter})
+
+		assert.Equal(t, "c1 --edited", model.selected)
+		// The edited entry replaces the original.
+		assert.Equal(t, []ctrl.HistoryEntry{
+			{Prompt: "p2", Command: "c2"},
+			{Prompt: "p1", Command: "c1 --edited"},
+		}, controller.LoadHistory())
+	})
+
+	t.Run("cancel editing", func(t *testing.T) {
+		controller := &FakeController{commands: []string{"ls -l", "ls -la"}}
+		model := New(controller)
+
+		model = typeTextIntoModel(model, "list files")
+		model = updateModel(model, tea.KeyMsg{Type: tea.KeyEnter})
+		model = updateModel(model, tea.KeyMsg{Type: tea.KeyCtrlE})
+		model = typeTextIntoModel(model, "h")
+		model = updateModel(model, tea.KeyMsg{Type: tea.KeyEsc})
+		assert.Equal(t, stateSelecting, model.state)
+
+		model = updateModel(model, tea.KeyMsg{Type: tea.KeyEnter})
+		assert.Equal(t, "ls -l", model.selected)
+	})
+
+	t.Run("edit key in prompt", func(t *testing.T) {
+		model := New(&FakeController{})
+
+		// Without an entry to edit, the key doesn't move the cursor either.
+		model = typeTextIntoModel(model, "list files")
+		for range 6 {
+			model = updateModel(model, tea.KeyMsg{Type: tea.KeyLeft})
+		}
+		model = updateModel(model, tea.KeyMsg{Type: tea.KeyCtrlE})
+		model = typeTextIntoModel(model, "X")
+		assert.Equal(t, statePrompting, model.state)
+		assert.Equal(t, "listX files", model.prompt.textInput.Value())
+	})
+}
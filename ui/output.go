@@ -0,0 +1,95 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/atotto/clipboard"
+	"github.com/aymanbagabas/go-osc52/v2"
+)
+
+// Targets for the selected command.
+const (
+	OutputStdout    = "stdout"
+	OutputClipboard = "clipboard"
+	OutputOSC52     = "osc52"
+)
+
+// OutputTargets lists all the supported output targets.
+var OutputTargets = []string{OutputStdout, OutputClipboard, OutputOSC52}
+
+// ValidateOutputTargets returns an error if any of the targets is unknown.
+func ValidateOutputTargets(targets []string) error {
+	for _, t := range targets {
+		switch t {
+		case OutputStdout, OutputClipboard, OutputOSC52:
+		default:
+			return fmt.Errorf("unknown output target %q, must be one of: %s", t, strings.Join(OutputTargets, ", "))
+		}
+	}
+	return nil
+}
+
+// output sends the selected command to all the targets in the options.
+func output(opts Options, command string) error {
+	targets := opts.OutputTo
+	if len(targets) == 0 {
+		targets = []string{OutputStdout}
+	}
+
+	var errs []error
+	for _, t := range targets {
+		var err error
+		switch t {
+		case OutputStdout:
+			if opts.TmuxPane != "" {
+				// The popup has no shell to print to.
+				err = tmuxSendKeys(opts.TmuxPane, command)
+			} else {
+				_, err = fmt.Println(command)
+			}
+		case OutputClipboard:
+			if err = clipboard.WriteAll(command); err != nil {
+				err = fmt.Errorf("copying to clipboard: %w", err)
+			}
+		case OutputOSC52:
+			err = writeOSC52(opts.TtyPath, command)
+		default:
+			err = fmt.Errorf("unknown output target %q", t)
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// writeOSC52 copies the text to the clipboard of the terminal emulator with
+// an OSC52 escape sequence, which also works over SSH. The sequence is
+// written to the terminal, as stdout is usually captured by the shell.
+func writeOSC52(ttyPath, text string) error {
+	if ttyPath == "" {
+		ttyPath = "/dev/tty"
+	}
+	var w io.Writer = os.Stderr
+	if tty, err := os.OpenFile(ttyPath, os.O_WRONLY, 0); err == nil {
+		defer tty.Close()
+		w = tty
+	}
+	if _, err := osc52Sequence(text).WriteTo(w); err != nil {
+		return fmt.Errorf("writing OSC52 sequence: %w", err)
+	}
+	return nil
+}
+
+func osc52Sequence(text string) osc52.Sequence {
+	seq := osc52.New(text)
+	if InTmux() {
+		// Requires `set -g allow-passthrough on` in tmux.
+		seq = seq.Tmux()
+	} else if strings.HasPrefix(os.Getenv("TERM"), "screen") {
+		seq = seq.Screen()
+	}
+	return seq
+}
@@ -0,0 +1,48 @@
+package ui
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateOutputTargets(t *testing.T) {
+	assert.NoError(t, ValidateOutputTargets(nil))
+	assert.NoError(t, ValidateOutputTargets([]string{"clipboard", "stdout", "osc52"}))
+	assert.ErrorContains(t, ValidateOutputTargets([]string{"stdout", "printer"}), `unknown output target "printer"`)
+}
+
+func TestWriteOSC52(t *testing.T) {
+	tests := []struct {
+		name string
+		tmux string
+		want string
+	}{
+		{
+			name: "terminal",
+			want: "\x1b]52;c;bHMgLWw=\x07",
+		},
+		{
+			name: "tmux",
+			tmux: "/tmp/tmux-1000/default,1234,0",
+			want: "\x1bPtmux;\x1b\x1b]52;c;bHMgLWw=\x07\x1b\\",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TMUX", tt.tmux)
+			t.Setenv("TERM", "xterm-256color")
+			// A regular file stands in for the terminal.
+			path := filepath.Join(t.TempDir(), "tty")
+			require.NoError(t, os.WriteFile(path, nil, 0o600))
+
+			require.NoError(t, writeOSC52(path, "ls -l"))
+			b, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(b))
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package ui
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mbrt/gencmd/ctrl"
+)
+
+// maxFileSuggestions bounds the files in the cwd suggested for a placeholder.
+const maxFileSuggestions = 100
+
+// suggestPlaceholder returns a default value for the placeholder and
+// suggestions for completing it, based on its name, the environment and the
+// files in dir.
+func suggestPlaceholder(p ctrl.Placeholder, dir string) (value string, suggestions []string) {
+	name := strings.ToLower(p.Name)
+	has := func(words ...string) bool {
+		for _, w := range words {
+			if strings.Contains(name, w) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case has("user"):
+		return os.Getenv("USER"), nil
+	case has("home"):
+		home, _ := os.UserHomeDir()
+		return home, nil
+	case has("host"):
+		host, _ := os.Hostname()
+		return host, nil
+	case has("file", "path", "dir", "folder") || filepath.Ext(name) != "":
+		files := listFiles(dir, has("dir", "folder"))
+		// Prefer files with the same extension, e.g. for <file.json>.
+		if ext := filepath.Ext(name); ext != "" {
+			for _, f := range files {
+				if strings.EqualFold(filepath.Ext(f), ext) {
+					return f, files
+				}
+			}
+		}
+		return "", files
+	default:
+		return "", nil
+	}
+}
+
+// listFiles returns the names of the non-hidden files in dir, or only the
+// directories if dirsOnly is set.
+func listFiles(dir string, dirsOnly bool) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var res []string
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") || (dirsOnly && !e.IsDir()) {
+			continue
+		}
+		res = append(res, e.Name())
+		if len(res) == maxFileSuggestions {
+			break
+		}
+	}
+	return res
+}
@@ -0,0 +1,40 @@
+package ui
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mbrt/gencmd/ctrl"
+)
+
+func TestPlaceholderSuggest(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.json", ".hidden.json"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o600))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0o700))
+	t.Setenv("USER", "alice")
+
+	tests := []struct {
+		name            string
+		wantValue       string
+		wantSuggestions []string
+	}{
+		{name: "username", wantValue: "alice"},
+		{name: "file.json", wantValue: "b.json", wantSuggestions: []string{"a.txt", "b.json", "sub"}},
+		{name: "input file", wantSuggestions: []string{"a.txt", "b.json", "sub"}},
+		{name: "directory", wantSuggestions: []string{"sub"}},
+		{name: "YOUR_BUCKET"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, suggestions := suggestPlaceholder(ctrl.Placeholder{Name: tt.name}, dir)
+			assert.Equal(t, tt.wantValue, value)
+			assert.Equal(t, tt.wantSuggestions, suggestions)
+		})
+	}
+}
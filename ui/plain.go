@@ -0,0 +1,201 @@
+package ui
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/mattn/go-isatty"
+
+	"github.com/mbrt/gencmd/ctrl"
+)
+
+// maxPlainMatches is the number of history entries shown in the plain UI.
+const maxPlainMatches = 10
+
+// terminalAvailable returns whether the interactive UI can run, either on the
+// given TTY or on stdin and stdout.
+func terminalAvailable(ttyPath string) bool {
+	if term := os.Getenv("TERM"); term == "dumb" {
+		return false
+	}
+	if ttyPath != "" {
+		tty, err := os.OpenFile(ttyPath, os.O_RDWR, 0)
+		if err != nil {
+			return false
+		}
+		defer tty.Close()
+		return isatty.IsTerminal(tty.Fd())
+	}
+	return isatty.IsTerminal(os.Stdin.Fd()) && isatty.IsTerminal(os.Stdout.Fd())
+}
+
+// runPlain runs a line oriented version of the UI, for when no terminal is
+// available (e.g. in editors, CI or dumb terminals), and returns the selected
+// command. Menus and prompts are written to errOut, and answers are read from
+// in.
+func runPlain(c Controller, in io.Reader, errOut io.Writer) (string, error) {
+	p := plainUI{
+		controller: c,
+		in:         bufio.NewScanner(in),
+		errOut:     errOut,
+	}
+	prompt, command, source, err := p.run()
+	if err != nil {
+		return "", err
+	}
+	selected, err := p.fill(command)
+	if err != nil {
+		return "", err
+	}
+	// History keeps the placeholders, as in the interactive UI.
+	if err := c.UpdateHistory(prompt, command, source); err != nil {
+		return "", err
+	}
+	return selected, nil
+}
+
+type plainUI struct {
+	controller Controller
+	in         *bufio.Scanner
+	errOut     io.Writer
+}
+
+// run returns the selected command, the prompt it was generated for and how
+// it was obtained (e.g. ctrl.SourceGenerated).
+func (p plainUI) run() (prompt, command, source string, err error) {
+	query, err := p.ask("Search history or type a new prompt: ")
+	if err != nil {
+		return "", "", "", err
+	}
+
+	if matches := p.searchHistory(query); len(matches) > 0 {
+		fmt.Fprintln(p.errOut, "\nHistory:")
+		for i, entry := range matches {
+			fmt.Fprintf(p.errOut, "%3d) %s\n     %s\n", i+1, entry.Prompt, entry.Command)
+		}
+		fmt.Fprintf(p.errOut, "  g) Generate commands for %q\n", query)
+
+		choice, err := p.choose(fmt.Sprintf("Select [1-%d, g]: ", len(matches)), len(matches), "g")
+		if err != nil {
+			return "", "", "", err
+		}
+		if choice > 0 {
+			entry := matches[choice-1]
+			return entry.Prompt, entry.Command, ctrl.SourceHistory, nil
+		}
+	}
+
+	fmt.Fprintln(p.errOut, "Generating commands...")
+	commands, err := p.controller.GenerateCommands(query)
+	if err != nil {
+		return "", "", "", err
+	}
+	switch len(commands) {
+	case 0:
+		return "", "", "", fmt.Errorf("no commands generated")
+	case 1:
+		return query, commands[0], ctrl.SourceGenerated, nil
+	}
+
+	fmt.Fprintln(p.errOut, "\nCompletions:")
+	for i, cmd := range commands {
+		fmt.Fprintf(p.errOut, "%3d) %s\n", i+1, cmd)
+	}
+	choice, err := p.choose(fmt.Sprintf("Select [1-%d]: ", len(commands)), len(commands), "")
+	if err != nil {
+		return "", "", "", err
+	}
+	return query, commands[choice-1], ctrl.SourceGenerated, nil
+}
+
+// fill asks for a value for each placeholder of the command, and returns the
+// command with the placeholders replaced. Empty answers select the default
+// value, if any.
+func (p plainUI) fill(command string) (string, error) {
+	placeholders := ctrl.FindPlaceholders(command)
+	if len(placeholders) == 0 {
+		return command, nil
+	}
+	dir, _ := os.Getwd()
+
+	fmt.Fprintf(p.errOut, "\nFill in the placeholders of: %s\n", command)
+	values := make(map[string]string, len(placeholders))
+	for _, ph := range placeholders {
+		def, _ := suggestPlaceholder(ph, dir)
+		if def != "" {
+			fmt.Fprintf(p.errOut, "%s [%s]: ", ph.Name, def)
+		} else {
+			fmt.Fprintf(p.errOut, "%s: ", ph.Name)
+		}
+		if !p.in.Scan() {
+			fmt.Fprintln(p.errOut)
+			return "", ErrUserCancel
+		}
+		value := strings.TrimSpace(p.in.Text())
+		if value == "" {
+			value = def
+		}
+		values[ph.Text] = value
+	}
+	return ctrl.FillPlaceholders(command, values), nil
+}
+
+// searchHistory returns the history entries matching the query, with the
+// same fuzzy matching as the interactive UI.
+func (p plainUI) searchHistory(query string) []historyEntry {
+	history := p.controller.LoadHistory()
+	targets := make([]string, len(history))
+	for i, entry := range history {
+		targets[i] = historyEntry{entry}.FilterValue()
+	}
+
+	var res []historyEntry
+	for _, rank := range list.DefaultFilter(query, targets) {
+		res = append(res, historyEntry{history[rank.Index]})
+		if len(res) == maxPlainMatches {
+			break
+		}
+	}
+	return res
+}
+
+// ask prints the question and returns the trimmed answer. An empty answer or
+// the end of the input cancel the operation.
+func (p plainUI) ask(question string) (string, error) {
+	fmt.Fprint(p.errOut, question)
+	if !p.in.Scan() {
+		fmt.Fprintln(p.errOut)
+		if err := p.in.Err(); err != nil {
+			return "", fmt.Errorf("reading input: %w", err)
+		}
+		return "", ErrUserCancel
+	}
+	answer := strings.TrimSpace(p.in.Text())
+	if answer == "" {
+		return "", ErrUserCancel
+	}
+	return answer, nil
+}
+
+// choose asks for a number between 1 and n, or the alternative answer (if not
+// empty), which is returned as 0. Invalid answers are asked again.
+func (p plainUI) choose(question string, n int, alt string) (int, error) {
+	for {
+		answer, err := p.ask(question)
+		if err != nil {
+			return 0, err
+		}
+		if alt != "" && strings.EqualFold(answer, alt) {
+			return 0, nil
+		}
+		if i, err := strconv.Atoi(answer); err == nil && i >= 1 && i <= n {
+			return i, nil
+		}
+		fmt.Fprintf(p.errOut, "Invalid choice %q\n", answer)
+	}
+}
@@ -0,0 +1,117 @@
+package ui
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mbrt/gencmd/ctrl"
+)
+
+func TestRunPlain(t *testing.T) {
+	tests := []struct {
+		name        string
+		history     []ctrl.HistoryEntry
+		commands    []string
+		input       string
+		want        string
+		wantErr     string
+		wantHistory ctrl.HistoryEntry
+	}{
+		{
+			name: "select from history",
+			history: []ctrl.HistoryEntry{
+				{Prompt: "list files", Command: "ls -l"},
+				{Prompt: "find files", Command: "find . -name '*.txt'"},
+				{Prompt: "list processes", Command: "ps aux"},
+			},
+			input:       "list\n2\n",
+			want:        "ps aux\n",
+			wantHistory: ctrl.HistoryEntry{Prompt: "list processes", Command: "ps aux", Source: ctrl.SourceHistory},
+		},
+		{
+			name: "generate despite matches",
+			history: []ctrl.HistoryEntry{
+				{Prompt: "list files", Command: "ls -l"},
+			},
+			commands:    []string{"ls -la", "ls -lh"},
+			input:       "list all files\ng\nx\n2\n",
+			want:        "ls -lh\n",
+			wantHistory: ctrl.HistoryEntry{Prompt: "list all files", Command: "ls -lh", Source: ctrl.SourceGenerated},
+		},
+		{
+			name:        "single command",
+			commands:    []string{"df -h"},
+			input:       "disk usage\n",
+			want:        "df -h\n",
+			wantHistory: ctrl.HistoryEntry{Prompt: "disk usage", Command: "df -h", Source: ctrl.SourceGenerated},
+		},
+		{
+			name: "fill placeholders",
+			history: []ctrl.HistoryEntry{
+				{Prompt: "kill user processes", Command: "pkill -u <username>"},
+			},
+			input:       "kill\n1\n\n",
+			want:        "pkill -u alice\n",
+			wantHistory: ctrl.HistoryEntry{Prompt: "kill user processes", Command: "pkill -u <username>", Source: ctrl.SourceHistory},
+		},
+		{
+			name:     "cancel",
+			commands: []string{"ls -la", "ls -lh"},
+			input:    "list files\n",
+			wantErr:  "cancelled",
+		},
+		{
+			name:    "no commands",
+			input:   "list files\n",
+			wantErr: "no commands",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("USER", "alice")
+			controller := &FakeController{
+				history:  tt.history,
+				commands: tt.commands,
+			}
+			var errOut bytes.Buffer
+
+			// Like RunUI without a terminal.
+			selected, err := runPlain(controller, strings.NewReader(tt.input), &errOut)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			out := captureStdout(t, func() {
+				require.NoError(t, output(Options{}, selected))
+			})
+			assert.Equal(t, tt.want, out)
+			history := controller.LoadHistory()
+			assert.Equal(t, tt.wantHistory, history[len(history)-1])
+		})
+	}
+}
+
+// captureStdout returns what f writes to stdout.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	// A regular file stands in for stdout.
+	file, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	require.NoError(t, err)
+	defer file.Close()
+	stdout := os.Stdout
+	os.Stdout = file
+	defer func() { os.Stdout = stdout }()
+
+	f()
+	b, err := os.ReadFile(file.Name())
+	require.NoError(t, err)
+	return string(b)
+}
@@ -1,8 +1,12 @@
 package ui
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
@@ -92,7 +96,7 @@ func (m promptModel) ShortHelp() []key.Binding {
 		m.keyMap.Submit,
 	}
 	if m.list.SelectedItem() != nil && m.historyVisible {
-		bindings = append(bindings, m.keyMap.Up, m.keyMap.Down)
+		bindings = append(bindings, m.keyMap.Up, m.keyMap.Down, m.keyMap.Edit)
 	}
 	bindings = append(bindings, m.keyMap.ToggleHelp)
 	return bindings
@@ -109,6 +113,7 @@ func (m promptModel) FullHelp() [][]key.Binding {
 			m.keyMap.Down,
 		},
 		{
+			m.keyMap.Edit,
 			m.keyMap.DeleteHistory,
 			m.keyMap.ToggleHistory,
 			m.keyMap.ToggleHelp,
@@ -204,7 +209,57 @@ func (h historyEntry) Title() string {
 }
 
 func (h historyEntry) Description() string {
-	return h.Command
+	home, _ := os.UserHomeDir()
+	return entryDescription(h.HistoryEntry, time.Now(), home)
+}
+
+// entryDescription returns the command of the entry, followed by when and
+// where it was last used, if known.
+func entryDescription(e ctrl.HistoryEntry, now time.Time, home string) string {
+	parts := []string{e.Command}
+	if !e.Timestamp.IsZero() {
+		parts = append(parts, relativeTime(e.Timestamp, now))
+	}
+	if e.Dir != "" {
+		parts = append(parts, shortenHome(e.Dir, home))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// relativeTime returns how long ago t was, in a compact human form.
+func relativeTime(t, now time.Time) string {
+	d := now.Sub(t)
+	day := 24 * time.Hour
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d/time.Minute))
+	case d < day:
+		return fmt.Sprintf("%dh ago", int(d/time.Hour))
+	case d < 7*day:
+		return fmt.Sprintf("%dd ago", int(d/day))
+	case d < 30*day:
+		return fmt.Sprintf("%dw ago", int(d/(7*day)))
+	case d < 365*day:
+		return fmt.Sprintf("%dmo ago", int(d/(30*day)))
+	default:
+		return fmt.Sprintf("%dy ago", int(d/(365*day)))
+	}
+}
+
+// shortenHome replaces the home directory prefix of the path with "~".
+func shortenHome(path, home string) string {
+	if home == "" {
+		return path
+	}
+	if path == home {
+		return "~"
+	}
+	if rest, ok := strings.CutPrefix(path, home+string(filepath.Separator)); ok {
+		return "~" + string(filepath.Separator) + rest
+	}
+	return path
 }
 
 func (m *promptModel) handleDeleteHistory() tea.Cmd {
@@ -0,0 +1,79 @@
+package ui
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mbrt/gencmd/ctrl"
+)
+
+func TestRelativeTime(t *testing.T) {
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		ago  time.Duration
+		want string
+	}{
+		{0, "just now"},
+		{-time.Minute, "just now"},
+		{59 * time.Second, "just now"},
+		{5 * time.Minute, "5m ago"},
+		{3*time.Hour + 59*time.Minute, "3h ago"},
+		{2 * 24 * time.Hour, "2d ago"},
+		{15 * 24 * time.Hour, "2w ago"},
+		{200 * 24 * time.Hour, "6mo ago"},
+		{800 * 24 * time.Hour, "2y ago"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.want, func(t *testing.T) {
+			assert.Equal(t, tc.want, relativeTime(now.Add(-tc.ago), now))
+		})
+	}
+}
+
+func TestEntryDescription(t *testing.T) {
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		entry ctrl.HistoryEntry
+		want  string
+	}{
+		{
+			name:  "no metadata",
+			entry: ctrl.HistoryEntry{Command: "ls -l"},
+			want:  "ls -l",
+		},
+		{
+			name: "in home",
+			entry: ctrl.HistoryEntry{
+				Command:   "ls -l",
+				Timestamp: now.Add(-2 * time.Hour),
+				Dir:       "/home/user/src/gencmd",
+			},
+			want: "ls -l · 2h ago · ~/src/gencmd",
+		},
+		{
+			name: "outside home",
+			entry: ctrl.HistoryEntry{
+				Command: "ls -l",
+				Dir:     "/home/username",
+			},
+			want: "ls -l · /home/username",
+		},
+		{
+			name: "home",
+			entry: ctrl.HistoryEntry{
+				Command:   "ls -l",
+				Timestamp: now,
+				Dir:       "/home/user",
+			},
+			want: "ls -l · just now · ~",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, entryDescription(tc.entry, now, "/home/user"))
+		})
+	}
+}
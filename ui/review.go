@@ -0,0 +1,110 @@
+package ui
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mbrt/gencmd/ctrl"
+)
+
+// ReviewImports asks which of the entries to import into history, in a line
+// oriented dialog reading answers from in and writing to errOut. Entries with
+// a prompt can be accepted, skipped or have their prompt edited, while for the
+// others a prompt is asked. Quitting, or the end of the input, returns the
+// entries accepted so far.
+func ReviewImports(entries []ctrl.HistoryEntry, in io.Reader, errOut io.Writer) ([]ctrl.HistoryEntry, error) {
+	r := reviewer{in: bufio.NewScanner(in), errOut: errOut}
+	var (
+		res       []ctrl.HistoryEntry
+		acceptAll bool
+	)
+	for i, entry := range entries {
+		fmt.Fprintf(errOut, "\n[%d/%d] %s\n", i+1, len(entries),
+			strings.ReplaceAll(entry.Command, "\n", "\n      "))
+
+		if entry.Prompt == "" {
+			prompt, ok := r.ask("Description (empty to skip, q to quit): ")
+			if !ok || prompt == "q" {
+				return res, r.in.Err()
+			}
+			if prompt != "" {
+				entry.Prompt = prompt
+				res = append(res, entry)
+			}
+			continue
+		}
+
+		fmt.Fprintf(errOut, "  Description: %s\n", entry.Prompt)
+		if acceptAll {
+			res = append(res, entry)
+			continue
+		}
+	loop:
+		for {
+			answer, ok := r.ask("Import? [Y]es, [n]o, [e]dit description, [a]ll remaining, [q]uit: ")
+			if !ok {
+				return res, r.in.Err()
+			}
+			switch strings.ToLower(answer) {
+			case "", "y", "yes":
+				res = append(res, entry)
+			case "n", "no":
+			case "e", "edit":
+				prompt, ok := r.ask("Description: ")
+				if !ok {
+					return res, r.in.Err()
+				}
+				if prompt == "" {
+					continue
+				}
+				entry.Prompt = prompt
+				res = append(res, entry)
+			case "a", "all":
+				acceptAll = true
+				res = append(res, entry)
+			case "q", "quit":
+				return res, nil
+			default:
+				fmt.Fprintf(errOut, "Invalid choice %q\n", answer)
+				continue
+			}
+			break loop
+		}
+	}
+	return res, nil
+}
+
+// Confirm asks the question, reading the answer from in and writing to
+// errOut, and returns whether it was answered yes. Any other answer, or the
+// end of the input, is a no.
+func Confirm(question string, in io.Reader, errOut io.Writer) (bool, error) {
+	r := reviewer{in: bufio.NewScanner(in), errOut: errOut}
+	answer, ok := r.ask(question + " [y/N]: ")
+	if !ok {
+		return false, r.in.Err()
+	}
+	switch strings.ToLower(answer) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+type reviewer struct {
+	in     *bufio.Scanner
+	errOut io.Writer
+}
+
+// ask prints the question and returns the trimmed answer, or false at the end
+// of the input.
+func (r reviewer) ask(question string) (string, bool) {
+	fmt.Fprint(r.errOut, question)
+	if !r.in.Scan() {
+		fmt.Fprintln(r.errOut)
+		return "", false
+	}
+	return strings.TrimSpace(r.in.Text()), true
+}
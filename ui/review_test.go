@@ -0,0 +1,85 @@
+package ui
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mbrt/gencmd/ctrl"
+)
+
+func TestReviewImports(t *testing.T) {
+	described := []ctrl.HistoryEntry{
+		{Prompt: "p1", Command: "c1"},
+		{Prompt: "p2", Command: "c2"},
+		{Prompt: "p3", Command: "c3"},
+	}
+	tests := []struct {
+		name    string
+		entries []ctrl.HistoryEntry
+		input   string
+		want    []ctrl.HistoryEntry
+	}{
+		{
+			name:    "accept and skip",
+			entries: described,
+			input:   "\nn\ny\n",
+			want: []ctrl.HistoryEntry{
+				{Prompt: "p1", Command: "c1"},
+				{Prompt: "p3", Command: "c3"},
+			},
+		},
+		{
+			name:    "edit",
+			entries: described,
+			input:   "e\nnew p1\nx\nn\nq\n",
+			want:    []ctrl.HistoryEntry{{Prompt: "new p1", Command: "c1"}},
+		},
+		{
+			name:    "all remaining",
+			entries: described,
+			input:   "n\na\n",
+			want: []ctrl.HistoryEntry{
+				{Prompt: "p2", Command: "c2"},
+				{Prompt: "p3", Command: "c3"},
+			},
+		},
+		{
+			name:    "end of input",
+			entries: described,
+			input:   "y\n",
+			want:    []ctrl.HistoryEntry{{Prompt: "p1", Command: "c1"}},
+		},
+		{
+			name: "ask descriptions",
+			entries: []ctrl.HistoryEntry{
+				{Command: "c1"},
+				{Command: "c2"},
+				{Command: "c3"},
+			},
+			input: "p1\n\nq\n",
+			want:  []ctrl.HistoryEntry{{Prompt: "p1", Command: "c1"}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var errOut bytes.Buffer
+			got, err := ReviewImports(tc.entries, strings.NewReader(tc.input), &errOut)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	for input, want := range map[string]bool{"y\n": true, "Yes\n": true, "\n": false, "n\n": false, "": false} {
+		var errOut bytes.Buffer
+		got, err := Confirm("Delete?", strings.NewReader(input), &errOut)
+		require.NoError(t, err)
+		assert.Equal(t, want, got, input)
+		assert.Contains(t, errOut.String(), "Delete? [y/N]: ")
+	}
+}
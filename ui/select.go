@@ -75,6 +75,7 @@ func (m selectModel) ShortHelp() []key.Binding {
 		m.keyMap.Cancel,
 		m.keyMap.Up,
 		m.keyMap.Down,
+		m.keyMap.Edit,
 	}
 }
 
@@ -0,0 +1,89 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// tmuxPaneEnv is set inside the popup to the pane the selection goes to.
+const tmuxPaneEnv = "GENCMD_TMUX_PANE"
+
+// TmuxOptions configure running the UI in a tmux popup.
+type TmuxOptions struct {
+	// Width and Height of the popup, as cells or percentage (e.g. 80%).
+	Width  string
+	Height string
+	// Pane is the ID of the pane to type the selection into. Defaults to
+	// the pane gencmd is running in.
+	Pane string
+	// Args are the arguments gencmd is started with inside the popup.
+	Args []string
+}
+
+// InTmux returns whether gencmd is running inside a tmux session.
+func InTmux() bool {
+	return os.Getenv("TMUX") != ""
+}
+
+// runTmuxPopup starts gencmd again in a tmux popup over the target pane. The
+// process in the popup types the selection into the pane by itself.
+func runTmuxPopup(opts TmuxOptions) error {
+	pane := opts.Pane
+	if pane == "" {
+		pane = os.Getenv("TMUX_PANE")
+	}
+	if pane == "" {
+		return errors.New("not running inside tmux")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("finding gencmd executable: %w", err)
+	}
+
+	args := []string{
+		"display-popup", "-E",
+		"-t", pane,
+		"-d", "#{pane_current_path}",
+	}
+	if opts.Width != "" {
+		args = append(args, "-w", opts.Width)
+	}
+	if opts.Height != "" {
+		args = append(args, "-h", opts.Height)
+	}
+	args = append(args, popupCommand(exe, opts.Args, pane))
+
+	c := exec.Command("tmux", args...)
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("opening tmux popup: %w", err)
+	}
+	return nil
+}
+
+// popupCommand returns the shell command running gencmd inside the popup.
+func popupCommand(exe string, args []string, pane string) string {
+	parts := []string{tmuxPaneEnv + "=" + shellQuote(pane), shellQuote(exe)}
+	for _, a := range args {
+		parts = append(parts, shellQuote(a))
+	}
+	return strings.Join(parts, " ")
+}
+
+// tmuxSendKeys types the text into the pane, without executing it.
+func tmuxSendKeys(pane, text string) error {
+	// A newline would run the command, so multi-line commands are joined.
+	text = strings.ReplaceAll(text, "\n", " ")
+	c := exec.Command("tmux", "send-keys", "-t", pane, "-l", "--", text)
+	if out, err := c.CombinedOutput(); err != nil {
+		return fmt.Errorf("sending selection to tmux pane %s: %w: %s", pane, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,12 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPopupCommand(t *testing.T) {
+	got := popupCommand("/usr/bin/gencmd", []string{"--tmux", "--shell=zsh", "it's"}, "%3")
+	assert.Equal(t, `GENCMD_TMUX_PANE='%3' '/usr/bin/gencmd' '--tmux' '--shell=zsh' 'it'\''s'`, got)
+}